@@ -0,0 +1,435 @@
+package cobracurl
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const altSvcTimeFormat = "20060102 15:04:05"
+
+// defaultAltSvcMaxAge is the lifetime of an Alt-Svc entry without ma=.
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// AltSvcEntry is one alternative service, as stored in curl's alt-svc file.
+type AltSvcEntry struct {
+	SrcALPN string
+	SrcHost string
+	SrcPort int
+	DstALPN string
+	DstHost string
+	DstPort int
+	Expires time.Time
+	Persist bool
+	Prio    int
+}
+
+func (e AltSvcEntry) dstAddr() string {
+	return net.JoinHostPort(e.DstHost, strconv.Itoa(e.DstPort))
+}
+
+// AltSvcCache holds alternative services learned from Alt-Svc response
+// headers and persists them in curl's alt-svc file format.
+type AltSvcCache struct {
+	mu      sync.Mutex
+	path    string
+	entries []AltSvcEntry
+}
+
+// LoadAltSvcCache reads the alt-svc cache file at path. A missing file
+// yields an empty cache that is created on the first Save.
+func LoadAltSvcCache(path string) (*AltSvcCache, error) {
+	c := &AltSvcCache{path: path}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading alt-svc cache: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseAltSvcLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("parsing alt-svc cache %s: %w", path, err)
+		}
+		c.entries = append(c.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading alt-svc cache: %w", err)
+	}
+
+	return c, nil
+}
+
+// parseAltSvcLine parses a line such as
+// `h2 example.com 443 h3 example.com 443 "20260101 10:00:00" 0 0`.
+func parseAltSvcLine(line string) (AltSvcEntry, error) {
+	dateStart := strings.IndexByte(line, '"')
+	dateEnd := strings.LastIndexByte(line, '"')
+	if dateStart < 0 || dateEnd <= dateStart {
+		return AltSvcEntry{}, fmt.Errorf("invalid line %q", line)
+	}
+	before := strings.Fields(line[:dateStart])
+	after := strings.Fields(line[dateEnd+1:])
+	if len(before) != 6 || len(after) != 2 {
+		return AltSvcEntry{}, fmt.Errorf("invalid line %q", line)
+	}
+
+	expires, err := time.Parse(altSvcTimeFormat, line[dateStart+1:dateEnd])
+	if err != nil {
+		return AltSvcEntry{}, fmt.Errorf("invalid date in %q: %w", line, err)
+	}
+	srcPort, err1 := strconv.Atoi(before[2])
+	dstPort, err2 := strconv.Atoi(before[5])
+	persist, err3 := strconv.Atoi(after[0])
+	prio, err4 := strconv.Atoi(after[1])
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return AltSvcEntry{}, fmt.Errorf("invalid number in %q: %w", line, err)
+	}
+
+	return AltSvcEntry{
+		SrcALPN: before[0],
+		SrcHost: strings.Trim(before[1], "[]"),
+		SrcPort: srcPort,
+		DstALPN: before[3],
+		DstHost: strings.Trim(before[4], "[]"),
+		DstPort: dstPort,
+		Expires: expires,
+		Persist: persist != 0,
+		Prio:    prio,
+	}, nil
+}
+
+// Save writes the unexpired entries to the cache file.
+func (c *AltSvcCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# Your alt-svc cache. https://curl.se/docs/alt-svc.html\n")
+	b.WriteString("# This file was generated by cobracurl! Edit at your own risk.\n")
+	now := time.Now()
+	for _, e := range c.entries {
+		if !e.Expires.After(now) {
+			continue
+		}
+		persist := 0
+		if e.Persist {
+			persist = 1
+		}
+		fmt.Fprintf(&b, "%s %s %d %s %s %d \"%s\" %d %d\n",
+			e.SrcALPN, altSvcHost(e.SrcHost), e.SrcPort,
+			e.DstALPN, altSvcHost(e.DstHost), e.DstPort,
+			e.Expires.UTC().Format(altSvcTimeFormat), persist, e.Prio)
+	}
+
+	if err := os.WriteFile(c.path, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("writing alt-svc cache: %w", err)
+	}
+	return nil
+}
+
+func altSvcHost(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// Entries returns the unexpired entries.
+func (c *AltSvcCache) Entries() []AltSvcEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries []AltSvcEntry
+	now := time.Now()
+	for _, e := range c.entries {
+		if e.Expires.After(now) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Lookup returns the first unexpired alternative for the origin host:port
+// whose protocol is one of alpns.
+func (c *AltSvcCache) Lookup(host string, port int, alpns ...string) (AltSvcEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for _, e := range c.entries {
+		if !strings.EqualFold(e.SrcHost, host) || e.SrcPort != port || !e.Expires.After(now) {
+			continue
+		}
+		for _, alpn := range alpns {
+			if e.DstALPN == alpn {
+				return e, true
+			}
+		}
+	}
+	return AltSvcEntry{}, false
+}
+
+// Update replaces the alternatives of the origin host:port with the ones
+// advertised in an Alt-Svc header received over srcALPN.
+func (c *AltSvcCache) Update(srcALPN, host string, port int, header string) {
+	alternatives, clearAll := parseAltSvcHeader(header)
+	if !clearAll && len(alternatives) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		if !strings.EqualFold(e.SrcHost, host) || e.SrcPort != port {
+			kept = append(kept, e)
+		}
+	}
+	c.entries = kept
+
+	now := time.Now()
+	for _, alt := range alternatives {
+		if alt.maxAge <= 0 {
+			continue
+		}
+		dstHost := alt.host
+		if dstHost == "" {
+			dstHost = host
+		}
+		c.entries = append(c.entries, AltSvcEntry{
+			SrcALPN: srcALPN,
+			SrcHost: host,
+			SrcPort: port,
+			DstALPN: alt.alpn,
+			DstHost: dstHost,
+			DstPort: alt.port,
+			Expires: now.Add(alt.maxAge),
+			Persist: alt.persist,
+		})
+	}
+}
+
+type altSvcAlternative struct {
+	alpn    string
+	host    string
+	port    int
+	maxAge  time.Duration
+	persist bool
+}
+
+// parseAltSvcHeader parses an Alt-Svc header value (RFC 7838). It reports
+// clearAll when the header is the "clear" keyword. Malformed alternatives are
+// skipped.
+func parseAltSvcHeader(header string) (alternatives []altSvcAlternative, clearAll bool) {
+	if strings.TrimSpace(header) == "clear" {
+		return nil, true
+	}
+
+	for _, value := range splitQuoted(header, ',') {
+		params := splitQuoted(value, ';')
+		alpn, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok {
+			continue
+		}
+		alpn, err := url.PathUnescape(strings.TrimSpace(alpn))
+		if err != nil {
+			continue
+		}
+		if alpn == "http/1.1" {
+			alpn = "h1"
+		}
+		host, portStr, err := net.SplitHostPort(strings.Trim(strings.TrimSpace(authority), `"`))
+		if err != nil {
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			continue
+		}
+
+		alt := altSvcAlternative{alpn: alpn, host: host, port: port, maxAge: defaultAltSvcMaxAge}
+		for _, param := range params[1:] {
+			name, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "ma":
+				if seconds, err := strconv.ParseInt(val, 10, 64); err == nil {
+					alt.maxAge = time.Duration(seconds) * time.Second
+				}
+			case "persist":
+				alt.persist = val == "1"
+			}
+		}
+		alternatives = append(alternatives, alt)
+	}
+	return alternatives, false
+}
+
+// splitQuoted splits s on sep, ignoring separators inside double-quoted
+// strings, which may contain backslash escapes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inQuotes, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// altSvcTransport records Alt-Svc headers of HTTPS responses into a cache
+// and connects later requests to the cached alternatives. HTTP/3
+// alternatives go through h3 and fall back to TCP when they fail; h1 and h2
+// alternatives are applied when dialing.
+type altSvcTransport struct {
+	cache *AltSvcCache
+	tcp   *http.Transport
+	h3    *http3.Transport
+	// saveError reports the errors saving the cache.
+	saveError func(error)
+}
+
+func newAltSvcTransport(cache *AltSvcCache, tcp *http.Transport, h3 *http3.Transport, saveError func(error)) *altSvcTransport {
+	t := &altSvcTransport{cache: cache, tcp: tcp, h3: h3, saveError: saveError}
+
+	dial := tcp.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	tcp.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if entry, ok := t.lookup(addr, "h2", "h1"); ok {
+			if conn, err := dial(ctx, network, entry.dstAddr()); err == nil {
+				return conn, nil
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+
+	if h3 != nil {
+		h3.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+			if entry, ok := t.lookup(addr, "h3"); ok {
+				addr = entry.dstAddr()
+			}
+			return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+		}
+	}
+
+	return t
+}
+
+func (t *altSvcTransport) lookup(addr string, alpns ...string) (AltSvcEntry, bool) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return AltSvcEntry{}, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return AltSvcEntry{}, false
+	}
+	return t.cache.Lookup(host, port, alpns...)
+}
+
+func (t *altSvcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" {
+		return t.tcp.RoundTrip(req)
+	}
+
+	if _, ok := t.lookup(canonicalAddr(req.URL), "h3"); ok && t.h3 != nil {
+		resp, err := t.h3.RoundTrip(req)
+		if err == nil {
+			return t.record(resp), nil
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+
+	resp, err := t.tcp.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.record(resp), nil
+}
+
+// record stores the Alt-Svc header of resp, if any, and saves the cache.
+func (t *altSvcTransport) record(resp *http.Response) *http.Response {
+	header := resp.Header.Get("Alt-Svc")
+	if header == "" || resp.Request == nil {
+		return resp
+	}
+
+	u := resp.Request.URL
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		port = 443
+	}
+
+	srcALPN := "h1"
+	switch resp.ProtoMajor {
+	case 2:
+		srcALPN = "h2"
+	case 3:
+		srcALPN = "h3"
+	}
+
+	t.cache.Update(srcALPN, u.Hostname(), port, header)
+	if err := t.cache.Save(); err != nil && t.saveError != nil {
+		t.saveError(err)
+	}
+	return resp
+}
+
+func (t *altSvcTransport) CloseIdleConnections() {
+	t.tcp.CloseIdleConnections()
+	if t.h3 != nil {
+		t.h3.CloseIdleConnections()
+	}
+}
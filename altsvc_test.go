@@ -0,0 +1,168 @@
+package cobracurl
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAltSvcHeader(t *testing.T) {
+	alts, clearAll := parseAltSvcHeader(`h3=":443"; ma=3600, h2="alt.example.com:8443"; persist=1, http%2F1.1="other:80", bogus`)
+	assert.False(t, clearAll)
+	require.Len(t, alts, 3)
+
+	assert.Equal(t, altSvcAlternative{alpn: "h3", port: 443, maxAge: time.Hour}, alts[0])
+	assert.Equal(t, altSvcAlternative{alpn: "h2", host: "alt.example.com", port: 8443, maxAge: defaultAltSvcMaxAge, persist: true}, alts[1])
+	assert.Equal(t, "h1", alts[2].alpn)
+
+	_, clearAll = parseAltSvcHeader("clear")
+	assert.True(t, clearAll)
+}
+
+func TestAltSvcCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "altsvc.txt")
+
+	cache, err := LoadAltSvcCache(path)
+	require.NoError(t, err)
+	assert.Empty(t, cache.Entries())
+
+	cache.Update("h2", "example.com", 443, `h3=":8443"; ma=60, h2="alt.example.com:443"`)
+	cache.Update("h2", "expired.example.com", 443, `h3=":443"; ma=0`)
+	require.NoError(t, cache.Save())
+
+	entry, ok := cache.Lookup("example.com", 443, "h3")
+	require.True(t, ok)
+	assert.Equal(t, "example.com", entry.DstHost)
+	assert.Equal(t, 8443, entry.DstPort)
+	_, ok = cache.Lookup("expired.example.com", 443, "h3")
+	assert.False(t, ok)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 4)
+	assert.True(t, strings.HasPrefix(lines[2], `h2 example.com 443 h3 example.com 8443 "`), lines[2])
+	assert.True(t, strings.HasSuffix(lines[3], `" 0 0`), lines[3])
+
+	reloaded, err := LoadAltSvcCache(path)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.Entries(), 2)
+
+	reloaded.Update("h2", "example.com", 443, "clear")
+	assert.Empty(t, reloaded.Entries())
+}
+
+func TestLoadAltSvcCacheSkipsExpired(t *testing.T) {
+	path := writeTempFile(t, []byte(
+		"# comment\n"+
+			`h2 example.com 443 h2 alt.example.com 443 "20000101 00:00:00" 0 0`+"\n"+
+			`h2 [::1] 443 h3 [::1] 8443 "29991231 00:00:00" 1 0`+"\n"))
+
+	cache, err := LoadAltSvcCache(path)
+	require.NoError(t, err)
+
+	_, ok := cache.Lookup("example.com", 443, "h2")
+	assert.False(t, ok)
+	entry, ok := cache.Lookup("::1", 443, "h3")
+	require.True(t, ok)
+	assert.True(t, entry.Persist)
+
+	_, err = LoadAltSvcCache(writeTempFile(t, []byte("garbage\n")))
+	assert.Error(t, err)
+}
+
+func TestBuildClientAltSvc(t *testing.T) {
+	reply := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "%s %s", name, r.Proto)
+		}
+	}
+
+	alt := httptest.NewTLSServer(reply("alt"))
+	defer alt.Close()
+	_, altPort, err := net.SplitHostPort(alt.Listener.Addr().String())
+	require.NoError(t, err)
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	h3 := &http3.Server{Handler: reply("alt"), TLSConfig: http3.ConfigureTLSConfig(alt.TLS.Clone())}
+	go func() { _ = h3.Serve(udpConn) }()
+	defer h3.Close()
+	h3Port := udpConn.LocalAddr().(*net.UDPAddr).Port
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "h2 alternative", header: fmt.Sprintf(`h2="127.0.0.1:%s"; ma=60`, altPort), expected: "alt HTTP/1.1"},
+		{name: "h3 alternative", header: fmt.Sprintf(`h3=":%d"; ma=60`, h3Port), expected: "alt HTTP/3.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Alt-Svc", tt.header)
+				reply("origin")(w, r)
+			}))
+			defer origin.Close()
+
+			cacheFile := filepath.Join(t.TempDir(), "altsvc.txt")
+			caFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: origin.Certificate().Raw}))
+
+			get := func() string {
+				cmd := &cobra.Command{}
+				cmd.Flags().String("cacert", caFile, "")
+				cmd.Flags().String("alt-svc", cacheFile, "")
+				client, err := BuildClient(cmd)
+				require.NoError(t, err)
+				defer client.CloseIdleConnections()
+
+				resp, err := client.Get(origin.URL)
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				return string(body)
+			}
+
+			assert.Equal(t, "origin HTTP/1.1", get())
+			assert.Equal(t, tt.expected, get())
+		})
+	}
+}
+
+func TestBuildClientAltSvcSaveError(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Alt-Svc", `h2=":443"; ma=60`)
+	}))
+	defer origin.Close()
+
+	var stderr strings.Builder
+	cmd := &cobra.Command{}
+	cmd.SetErr(&stderr)
+	cmd.Flags().Bool("insecure", true, "")
+	cmd.Flags().String("alt-svc", filepath.Join(t.TempDir(), "missing", "altsvc.txt"), "")
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	for range 2 {
+		resp, err := client.Get(origin.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, 1, strings.Count(stderr.String(), "Warning: writing alt-svc cache:"), stderr.String())
+}
@@ -0,0 +1,371 @@
+package cobracurl
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// userCredentials returns the user name and password to send to the host of
+// u, in curl's order of precedence:
+//
+//  1. --user user:password
+//  2. user and password in the URL
+//  3. the netrc entry for the host, restricted to the login given with
+//     --user or in the URL
+//  4. --user user, with the password prompted for when prompt is set; the
+//     answer is kept with the command so that the prompt is shown once
+//  5. a URL user without password, sent with an empty password
+//
+// When u is nil, only --user is used. The netrc file is skipped when the
+// host is unknown.
+func userCredentials(cmd *cobra.Command, u *url.URL, prompt bool) (string, string, bool, error) {
+	userArg, _ := cmd.Flags().GetString("user")
+	if username, password, ok := strings.Cut(userArg, ":"); ok {
+		return strings.TrimSpace(username), strings.TrimSpace(password), true, nil
+	}
+	if u == nil {
+		u = &url.URL{}
+	}
+
+	var urlUser string
+	if u.User != nil {
+		urlUser = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			return urlUser, password, true, nil
+		}
+	}
+
+	login := strings.TrimSpace(userArg)
+	if login == "" {
+		login = urlUser
+	}
+	var username, password string
+	var ok bool
+	var err error
+	if host := u.Hostname(); host != "" {
+		username, password, ok, err = netrcCredentials(cmd, host, login)
+	}
+	switch {
+	case ok:
+		return username, password, true, nil
+	case strings.TrimSpace(userArg) != "":
+		password, ok, err := promptedPassword(cmd, login, prompt)
+		if err != nil || !ok {
+			return "", "", false, err
+		}
+		return login, password, true, nil
+	case urlUser != "" && err == nil:
+		return urlUser, "", true, nil
+	}
+	return "", "", false, err
+}
+
+// credentialsFunc returns the user name and password to send to the host of
+// u, and false when there are none.
+type credentialsFunc func(u *url.URL) (string, string, bool)
+
+// usesBasicAuth reports whether --user credentials are sent as a Basic
+// Authorization header, which is the case with --basic or when no other
+// scheme is selected.
+func usesBasicAuth(cmd *cobra.Command) bool {
+	if basic, _ := cmd.Flags().GetBool("basic"); basic {
+		return true
+	}
+	digest, _ := cmd.Flags().GetBool("digest")
+	anyauth, _ := cmd.Flags().GetBool("anyauth")
+	ntlm, _ := cmd.Flags().GetBool("ntlm")
+	awsSigV4, _ := cmd.Flags().GetString("aws-sigv4")
+	return !digest && !anyauth && !ntlm && awsSigV4 == ""
+}
+
+// authTransport wraps next with the round tripper answering the
+// authentication challenges of the scheme selected on the command. It
+// returns next when credentials are sent by BuildRequest or missing.
+//
+// When --user has no password, it is prompted for here, unless the netrc
+// file has one for the --url host, so that the round trippers never prompt.
+func authTransport(cmd *cobra.Command, next http.RoundTripper) (http.RoundTripper, error) {
+	if usesBasicAuth(cmd) {
+		return next, nil
+	}
+
+	if userArg, _ := cmd.Flags().GetString("user"); strings.TrimSpace(userArg) != "" && !strings.Contains(userArg, ":") {
+		if _, _, _, err := userCredentials(cmd, flagURL(cmd), true); err != nil {
+			return nil, err
+		}
+	}
+	credentials := func(u *url.URL) (string, string, bool) {
+		username, password, ok, err := userCredentials(cmd, u, false)
+		return username, password, ok && err == nil
+	}
+	trusted, _ := cmd.Flags().GetBool("location-trusted")
+	if anyauth, _ := cmd.Flags().GetBool("anyauth"); anyauth {
+		return newAnyAuthTransport(credentials, trusted, next), nil
+	}
+	if digest, _ := cmd.Flags().GetBool("digest"); digest {
+		return newDigestTransport(credentials, trusted, next), nil
+	}
+	if ntlm, _ := cmd.Flags().GetBool("ntlm"); ntlm {
+		return newNTLMTransport(credentials, trusted, false, next), nil
+	}
+	return next, nil
+}
+
+// flagURL returns the parsed --url, or nil when it is missing or invalid.
+func flagURL(cmd *cobra.Command) *url.URL {
+	rawURL, _ := cmd.Flags().GetString("url")
+	if rawURL == "" {
+		return nil
+	}
+	u, _ := url.Parse(rawURL)
+	return u
+}
+
+// proxyCredentials returns the --proxy-user credentials, falling back to
+// the user and password of the proxy URL.
+func proxyCredentials(cmd *cobra.Command, proxyURL *url.URL) (string, string, bool) {
+	if proxyUser, _ := cmd.Flags().GetString("proxy-user"); proxyUser != "" {
+		username, password, _ := strings.Cut(proxyUser, ":")
+		return username, password, true
+	}
+	if proxyURL.User == nil {
+		return "", "", false
+	}
+	password, _ := proxyURL.User.Password()
+	return proxyURL.User.Username(), password, true
+}
+
+// anyAuthTransport sends requests without credentials first and answers a
+// 401 with the strongest scheme the server offers. The scheme picked for a
+// host is used right away for later requests.
+type anyAuthTransport struct {
+	credentials credentialsFunc
+	trusted     bool
+	next        http.RoundTripper
+	digest      *digestTransport
+
+	mu      sync.Mutex
+	schemes map[string]string
+}
+
+func newAnyAuthTransport(credentials credentialsFunc, trusted bool, next http.RoundTripper) *anyAuthTransport {
+	return &anyAuthTransport{
+		credentials: credentials,
+		trusted:     trusted,
+		next:        next,
+		digest:      newDigestTransport(credentials, trusted, next),
+		schemes:     map[string]string{},
+	}
+}
+
+func (t *anyAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	username, password, ok := t.credentials(req.URL)
+	if !ok || !authAllowed(req, t.trusted) {
+		return t.next.RoundTrip(req)
+	}
+
+	req, err := replayableRequest(withoutUserinfo(req))
+	if err != nil {
+		return nil, err
+	}
+
+	host := req.URL.Host
+	t.mu.Lock()
+	scheme := t.schemes[host]
+	t.mu.Unlock()
+	switch scheme {
+	case "Digest":
+		return t.digest.RoundTrip(req)
+	case "Basic":
+		return t.next.RoundTrip(withBasicAuth(req, username, password))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenges := parseAuthChallenges(resp.Header.Values("WWW-Authenticate"))
+	digestChallenge := newDigestChallenge(challenges)
+	switch {
+	case digestChallenge != nil:
+		scheme = "Digest"
+		t.digest.setChallenge(host, digestChallenge)
+	case slices.ContainsFunc(challenges, func(c authChallenge) bool { return strings.EqualFold(c.Scheme, "Basic") }):
+		scheme = "Basic"
+	default:
+		return resp, nil
+	}
+	discardResponse(resp)
+
+	t.mu.Lock()
+	t.schemes[host] = scheme
+	t.mu.Unlock()
+
+	retry, err := rewindBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == "Digest" {
+		return t.digest.RoundTrip(retry)
+	}
+	return t.next.RoundTrip(withBasicAuth(retry, username, password))
+}
+
+func withBasicAuth(req *http.Request, username, password string) *http.Request {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(username, password)
+	return req
+}
+
+func (t *anyAuthTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// authAllowed reports whether credentials may be sent with req. Like curl,
+// redirects to another host only get them with --location-trusted.
+func authAllowed(req *http.Request, trusted bool) bool {
+	if trusted {
+		return true
+	}
+	original := req
+	for original.Response != nil && original.Response.Request != nil {
+		original = original.Response.Request
+	}
+	return original == req || strings.EqualFold(original.URL.Host, req.URL.Host)
+}
+
+// authChallenge is one challenge of a WWW-Authenticate header, holding
+// either auth-params or a token68 value.
+type authChallenge struct {
+	Scheme string
+	Params map[string]string
+	Token  string
+}
+
+// parseAuthChallenges parses WWW-Authenticate header values (RFC 9110
+// section 11.6.1), which may each hold several challenges.
+func parseAuthChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, value := range values {
+		for _, part := range splitQuoted(value, ',') {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			name, rest, _ := strings.Cut(part, " ")
+			isParam := strings.Contains(name, "=") || strings.HasPrefix(strings.TrimSpace(rest), "=")
+			if !isParam {
+				challenges = append(challenges, authChallenge{Scheme: name, Params: map[string]string{}})
+				part = strings.TrimSpace(rest)
+				if part == "" {
+					continue
+				}
+				if isToken68(part) {
+					challenges[len(challenges)-1].Token = part
+					continue
+				}
+			}
+			if len(challenges) == 0 {
+				continue
+			}
+
+			key, val, _ := strings.Cut(part, "=")
+			challenges[len(challenges)-1].Params[strings.ToLower(strings.TrimSpace(key))] = unquote(strings.TrimSpace(val))
+		}
+	}
+	return challenges
+}
+
+// isToken68 reports whether s is a token68 value, as used by schemes such
+// as NTLM, rather than an auth-param.
+func isToken68(s string) bool {
+	value := strings.TrimRight(s, "=")
+	if value == "" {
+		return false
+	}
+	for _, c := range value {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && !strings.ContainsRune("-._~+/", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// replayableRequest makes sure req can be sent again after an
+// authentication challenge, buffering a body that has no GetBody.
+func replayableRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return req, nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Body, _ = req.GetBody()
+	req.ContentLength = int64(len(data))
+	return req, nil
+}
+
+// withoutUserinfo returns req without URL credentials, which net/http
+// would otherwise send as Basic authentication.
+func withoutUserinfo(req *http.Request) *http.Request {
+	if req.URL.User == nil {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.URL.User = nil
+	return req
+}
+
+// rewindBody returns a copy of req with a fresh body.
+func rewindBody(req *http.Request) (*http.Request, error) {
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
+
+// discardResponse drains and closes a response that is being replaced. The
+// whole body is read so that the connection is kept for the next request,
+// which connection-based schemes such as NTLM depend on.
+func discardResponse(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,150 @@
+package cobracurl
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	awsTestAccessKey = "AKIDEXAMPLE"
+	awsTestSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+func TestParseAWSSigV4(t *testing.T) {
+	cfg, err := ParseAWSSigV4("aws:amz:us-east-2:es")
+	require.NoError(t, err)
+	assert.Equal(t, AWSSigV4Config{Provider1: "aws", Provider2: "amz", Region: "us-east-2", Service: "es"}, cfg)
+
+	cfg, err = ParseAWSSigV4("aws")
+	require.NoError(t, err)
+	assert.Equal(t, AWSSigV4Config{Provider1: "aws", Provider2: "aws"}, cfg)
+
+	_, err = ParseAWSSigV4("")
+	require.ErrorIs(t, err, ErrInvalidAWSSigV4)
+	_, err = ParseAWSSigV4("a:b:c:d:e")
+	require.ErrorIs(t, err, ErrInvalidAWSSigV4)
+}
+
+// TestSignAWSSigV4TestSuite checks requests of the AWS Signature Version 4
+// test suite.
+func TestSignAWSSigV4TestSuite(t *testing.T) {
+	tests := []struct {
+		name              string
+		method            string
+		path              string
+		headers           map[string]string
+		body              string
+		expectedSigned    string
+		expectedSignature string
+	}{
+		{
+			name:              "get-vanilla",
+			method:            http.MethodGet,
+			path:              "/",
+			expectedSigned:    "host;x-amz-date",
+			expectedSignature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:              "get-vanilla-query-order-key-case",
+			method:            http.MethodGet,
+			path:              "/?Param2=value2&Param1=value1",
+			expectedSigned:    "host;x-amz-date",
+			expectedSignature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:              "post-vanilla",
+			method:            http.MethodPost,
+			path:              "/",
+			expectedSigned:    "host;x-amz-date",
+			expectedSignature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:              "post-header-key-sort",
+			method:            http.MethodPost,
+			path:              "/",
+			headers:           map[string]string{"My-Header1": "value1"},
+			expectedSigned:    "host;my-header1;x-amz-date",
+			expectedSignature: "c5410059b04c1ee005303aed430f6e6645f61f4dc9e1461ec8f8916fdf18852c",
+		},
+		{
+			name:              "post-x-www-form-urlencoded",
+			method:            http.MethodPost,
+			path:              "/",
+			headers:           map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:              "Param1=value1",
+			expectedSigned:    "content-type;host;x-amz-date",
+			expectedSignature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+		{
+			name:              "get-slash-dot-slash",
+			method:            http.MethodGet,
+			path:              "/./",
+			expectedSigned:    "host;x-amz-date",
+			expectedSignature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+	}
+
+	cfg := AWSSigV4Config{Provider1: "aws", Provider2: "amz", Region: "us-east-1", Service: "service"}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "https://example.amazonaws.com"+tt.path, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			require.NoError(t, SignAWSSigV4(req, cfg, awsTestAccessKey, awsTestSecretKey, now))
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders="+tt.expectedSigned+", Signature="+tt.expectedSignature, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestBuildRequestAWSSigV4(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", "")
+	cmd.Flags().String("user", awsTestAccessKey+":"+awsTestSecretKey, "")
+	cmd.Flags().String("aws-sigv4", "aws:amz:us-east-1:iam", "")
+	cmd.Flags().String("user-agent", "", "")
+	cmd.Flags().StringArray("header", []string{
+		"Content-Type: application/x-www-form-urlencoded; charset=utf-8",
+		"X-Amz-Date: 20150830T123600Z",
+	}, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+
+	authorization := req.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;user-agent;x-amz-date, Signature="), authorization)
+	_, _, basic := req.BasicAuth()
+	assert.False(t, basic)
+}
+
+func TestBuildRequestAWSSigV4InfersRegionAndService(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "https://s3.eu-west-1.amazonaws.com/bucket/key", "")
+	cmd.Flags().String("user", "AKID:secret", "")
+	cmd.Flags().String("aws-sigv4", "aws:amz", "")
+	cmd.Flags().StringArray("header", []string{"X-Amz-Security-Token: session-token"}, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+
+	authorization := req.Header.Get("Authorization")
+	assert.Contains(t, authorization, "/eu-west-1/s3/aws4_request, ")
+	assert.Contains(t, authorization, ";x-amz-content-sha256;x-amz-date;x-amz-security-token,")
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", req.Header.Get("X-Amz-Content-Sha256"))
+
+	require.NoError(t, cmd.Flags().Set("url", "http://localhost/"))
+	_, err = BuildRequest(cmd, nil)
+	require.ErrorIs(t, err, ErrInvalidAWSSigV4)
+}
@@ -3,13 +3,16 @@ package cobracurl
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
 	"github.com/spf13/cobra"
 )
 
@@ -75,15 +78,135 @@ func BuildClient(cmd *cobra.Command) (*http.Client, error) {
 		transport.DisableKeepAlives = true
 	}
 
+	var proxyNTLM credentialsFunc
 	if proxyStr, _ := cmd.Flags().GetString("proxy"); proxyStr != "" {
 		proxyURL, err := url.Parse(proxyStr)
 		if err != nil {
 			return nil, err
 		}
 		transport.Proxy = http.ProxyURL(proxyURL)
+
+		useProxyNTLM, _ := cmd.Flags().GetBool("proxy-ntlm")
+		if username, password, ok := proxyCredentials(cmd, proxyURL); useProxyNTLM && ok {
+			// net/http would send the proxy URL credentials as Basic.
+			proxyURL.User = nil
+			proxyNTLM = func(*url.URL) (string, string, bool) { return username, password, true }
+			// Tunnels are opened by the dialer, which runs the handshake on
+			// the CONNECT requests; plain HTTP requests are forwarded to the
+			// proxy and authenticated by ntlmTransport.
+			transport.Proxy = func(req *http.Request) (*url.URL, error) {
+				if req.URL.Scheme == "https" {
+					return nil, nil
+				}
+				return proxyURL, nil
+			}
+			transport.DialContext = ntlmProxyDialer(dialer.DialContext, proxyURL, username, password)
+		}
+	}
+
+	var roundTripper http.RoundTripper = transport
+
+	http3Only, _ := cmd.Flags().GetBool("http3-only")
+	useHTTP3, _ := cmd.Flags().GetBool("http3")
+	if http3Only && transport.Proxy != nil {
+		return nil, errors.New("http3-only cannot be used with a proxy")
+	}
+
+	http09, _ := cmd.Flags().GetBool("http0.9")
+	raw, _ := cmd.Flags().GetBool("raw")
+	if raw {
+		transport.DisableCompression = true
+	}
+
+	http10, _ := cmd.Flags().GetBool("http1.0")
+	http11, _ := cmd.Flags().GetBool("http1.1")
+	ntlm, _ := cmd.Flags().GetBool("ntlm")
+	http2, _ := cmd.Flags().GetBool("http2")
+	http2PriorKnowledge, _ := cmd.Flags().GetBool("http2-prior-knowledge")
+	useNTLM := ntlm || proxyNTLM != nil
+	if useNTLM && (http10 || raw || noKeepalive) {
+		// These send each request on a new connection, which loses the
+		// NTLM handshake.
+		return nil, errors.New("ntlm and proxy-ntlm cannot be used with http1.0, raw or no-keepalive")
+	}
+	if useNTLM && (http2 || http2PriorKnowledge || useHTTP3 || http3Only) {
+		// NTLM authenticates HTTP/1.1 connections, not HTTP/2 or HTTP/3 streams.
+		return nil, errors.New("ntlm and proxy-ntlm cannot be used with http2, http2-prior-knowledge, http3 or http3-only")
+	}
+	if raw && (http2 || http2PriorKnowledge || useHTTP3 || http3Only) {
+		return nil, errors.New("raw cannot be used with http2, http2-prior-knowledge, http3 or http3-only")
+	}
+	switch {
+	case http3Only:
+		roundTripper = newHTTP3Transport(transport, dialer.Timeout)
+	case useHTTP3:
+		transport.ForceAttemptHTTP2 = true
+		delay := DefaultHappyEyeballsTimeout
+		if ms, _ := cmd.Flags().GetInt("happy-eyeballs-timeout-ms"); ms > 0 {
+			delay = time.Duration(ms) * time.Millisecond
+		}
+		roundTripper = newHTTP3RaceTransport(transport, newHTTP3Transport(transport, dialer.Timeout), delay)
+	case http10:
+		roundTripper = newRawTransport(transport, 1, 0)
+	case raw:
+		// net/http always decodes chunked bodies.
+		roundTripper = newRawTransport(transport, 1, 1)
+	case http11 || useNTLM:
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	case http2PriorKnowledge:
+		// Speak HTTP/2 right away on cleartext connections (h2c) and over TLS.
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = protocols
+	case http2:
+		// Only HTTPS requires HTTP/2; like curl, cleartext URLs stay on HTTP/1.1.
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		transport.Protocols = protocols
+	default:
+		transport.ForceAttemptHTTP2 = true
+	}
+	if rt, ok := roundTripper.(*rawTransport); ok {
+		rt.AllowHTTP09, rt.Raw = http09, raw
+	}
+	// net/http rejects HTTP/0.9 responses as malformed.
+	transport.DialContext = http09DialContext(transport.DialContext, http09)
+
+	if altSvcFile, _ := cmd.Flags().GetString("alt-svc"); altSvcFile != "" && roundTripper == transport {
+		cache, err := LoadAltSvcCache(altSvcFile)
+		if err != nil {
+			return nil, err
+		}
+		var h3 *http3.Transport
+		if !http11 && !http2 && !http2PriorKnowledge && !useNTLM {
+			h3 = newHTTP3Transport(transport, dialer.Timeout)
+		}
+		roundTripper = newAltSvcTransport(cache, transport, h3, cacheSaveWarning(cmd))
+	}
+
+	if proxyNTLM != nil {
+		roundTripper = newNTLMTransport(proxyNTLM, true, true, roundTripper)
+	}
+	roundTripper, err := authTransport(cmd, roundTripper)
+	if err != nil {
+		return nil, err
+	}
+
+	continueAt, _ := cmd.Flags().GetInt64("continue-at")
+	if appendUpload, _ := cmd.Flags().GetBool("append"); continueAt != 0 || appendUpload {
+		roundTripper = &resumeTransport{next: roundTripper}
+	}
+
+	if hstsFile, _ := cmd.Flags().GetString("hsts"); hstsFile != "" {
+		cache, err := LoadHSTSCache(hstsFile)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = &hstsTransport{cache: cache, next: roundTripper, saveError: cacheSaveWarning(cmd)}
 	}
 
-	client := &http.Client{Transport: transport}
+	client := &http.Client{Transport: roundTripper}
 
 	if maxTime, _ := cmd.Flags().GetFloat64("max-time"); maxTime > 0 {
 		client.Timeout = time.Duration(maxTime * float64(time.Second))
@@ -95,16 +218,64 @@ func BuildClient(cmd *cobra.Command) (*http.Client, error) {
 			return http.ErrUseLastResponse
 		}
 	} else {
-		maxRedirs, _ := cmd.Flags().GetInt("max-redirs")
-		if maxRedirs > 0 {
-			client.CheckRedirect = func(_ *http.Request, via []*http.Request) error {
-				if len(via) >= maxRedirs {
-					return http.ErrUseLastResponse
+		var policies []func(req *http.Request, via []*http.Request) error
+
+		maxRedirs := DefaultMaxRedirs
+		if cmd.Flags().Lookup("max-redirs") != nil {
+			maxRedirs, _ = cmd.Flags().GetInt("max-redirs")
+		}
+		if maxRedirs < -1 {
+			return nil, fmt.Errorf("invalid max-redirs %d: must be -1 or greater", maxRedirs)
+		}
+		if maxRedirs >= 0 {
+			policies = append(policies, func(_ *http.Request, via []*http.Request) error {
+				if len(via) > maxRedirs {
+					return &TooManyRedirectsError{Max: maxRedirs}
+				}
+				return nil
+			})
+		}
+
+		proto, _ := cmd.Flags().GetString("proto")
+		protoRedir, _ := cmd.Flags().GetString("proto-redir")
+		if proto != "" || protoRedir != "" {
+			allowed, redirect := BuildProtocols(cmd)
+			policies = append(policies, func(req *http.Request, _ []*http.Request) error {
+				if scheme := req.URL.Scheme; !allowed.Allows(scheme) || !redirect.Allows(scheme) {
+					return fmt.Errorf("%w: redirect to %s", ErrUnsupportedProtocol, scheme)
+				}
+				return nil
+			})
+		}
+
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			for _, policy := range policies {
+				if err := policy(req, via); err != nil {
+					return err
 				}
+			}
+			if req == nil || req.Response == nil {
 				return nil
 			}
+			if rec := RedirectRecorderFromContext(req.Context()); rec != nil {
+				rec.record(req.Response)
+			}
+			return nil
 		}
 	}
 
 	return client, nil
 }
+
+// cacheSaveWarning returns a function printing an error saving the --alt-svc
+// or --hsts cache as a warning on the command's error output. Only the
+// first error is printed, so that a read-only cache does not warn on every
+// response.
+func cacheSaveWarning(cmd *cobra.Command) func(error) {
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v\n", err)
+		})
+	}
+}
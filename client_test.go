@@ -7,8 +7,11 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
+	"io"
 	"math/big"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -90,7 +93,9 @@ func TestBuildClient(t *testing.T) {
 				"location": true,
 			},
 			assertFn: func(t *testing.T, client *http.Client) {
-				assert.Nil(t, client.CheckRedirect)
+				require.NotNil(t, client.CheckRedirect)
+				req := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+				assert.NoError(t, client.CheckRedirect(req, make([]*http.Request, 2)))
 			},
 		},
 		{
@@ -101,12 +106,56 @@ func TestBuildClient(t *testing.T) {
 			},
 			assertFn: func(t *testing.T, client *http.Client) {
 				require.NotNil(t, client.CheckRedirect)
-				via := make([]*http.Request, 3)
-				assert.Equal(t, http.ErrUseLastResponse, client.CheckRedirect(nil, via))
-				via = make([]*http.Request, 2)
+				via := make([]*http.Request, 4)
+				assert.ErrorIs(t, client.CheckRedirect(nil, via), ErrTooManyRedirects)
+				via = make([]*http.Request, 3)
 				assert.NoError(t, client.CheckRedirect(nil, via))
 			},
 		},
+		{
+			name: "Location with max-redirs 0 refuses the first redirect",
+			flags: map[string]interface{}{
+				"location":   true,
+				"max-redirs": 0,
+			},
+			assertFn: func(t *testing.T, client *http.Client) {
+				require.NotNil(t, client.CheckRedirect)
+				err := client.CheckRedirect(nil, make([]*http.Request, 1))
+				var tooMany *TooManyRedirectsError
+				require.ErrorAs(t, err, &tooMany)
+				assert.Equal(t, 0, tooMany.Max)
+			},
+		},
+		{
+			name: "Location with max-redirs -1 is unlimited",
+			flags: map[string]interface{}{
+				"location":   true,
+				"max-redirs": -1,
+			},
+			assertFn: func(t *testing.T, client *http.Client) {
+				require.NotNil(t, client.CheckRedirect)
+				assert.NoError(t, client.CheckRedirect(nil, make([]*http.Request, 1000)))
+			},
+		},
+		{
+			name: "Location without max-redirs uses the default limit",
+			flags: map[string]interface{}{
+				"location": true,
+			},
+			assertFn: func(t *testing.T, client *http.Client) {
+				require.NotNil(t, client.CheckRedirect)
+				assert.NoError(t, client.CheckRedirect(nil, make([]*http.Request, DefaultMaxRedirs)))
+				assert.ErrorIs(t, client.CheckRedirect(nil, make([]*http.Request, DefaultMaxRedirs+1)), ErrTooManyRedirects)
+			},
+		},
+		{
+			name: "max-redirs below -1 returns error",
+			flags: map[string]interface{}{
+				"location":   true,
+				"max-redirs": -2,
+			},
+			expectedErrorMsg: "invalid max-redirs",
+		},
 		{
 			name: "Max-time sets client timeout",
 			flags: map[string]interface{}{
@@ -300,3 +349,94 @@ func TestBuildClientTLS(t *testing.T) {
 		assert.Contains(t, err.Error(), "loading client certificate")
 	})
 }
+
+func TestBuildClientHTTPVersion(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+
+	h2Server := httptest.NewUnstartedServer(handler)
+	h2Server.EnableHTTP2 = true
+	h2Server.StartTLS()
+	defer h2Server.Close()
+
+	h1Server := httptest.NewTLSServer(handler)
+	defer h1Server.Close()
+
+	certFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h2Server.Certificate().Raw}))
+	h1CertFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: h1Server.Certificate().Raw}))
+
+	tests := []struct {
+		name          string
+		versionFlag   string
+		serverURL     string
+		cacert        string
+		expectedProto string
+		expectedError bool
+	}{
+		{name: "default negotiates HTTP/2", serverURL: h2Server.URL, cacert: certFile, expectedProto: "HTTP/2.0"},
+		{name: "http1.1 disables HTTP/2", versionFlag: "http1.1", serverURL: h2Server.URL, cacert: certFile, expectedProto: "HTTP/1.1"},
+		{name: "http1.0 sends HTTP/1.0", versionFlag: "http1.0", serverURL: h2Server.URL, cacert: certFile, expectedProto: "HTTP/1.0"},
+		{name: "http2 uses HTTP/2", versionFlag: "http2", serverURL: h2Server.URL, cacert: certFile, expectedProto: "HTTP/2.0"},
+		{name: "http2 fails without HTTP/2 support", versionFlag: "http2", serverURL: h1Server.URL, cacert: h1CertFile, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("cacert", tt.cacert, "")
+			if tt.versionFlag != "" {
+				cmd.Flags().Bool(tt.versionFlag, true, "")
+			}
+
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			resp, err := client.Get(tt.serverURL)
+			if tt.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedProto, string(body))
+		})
+	}
+}
+
+func TestBuildClientHTTP2PriorKnowledge(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Config.Protocols = protocols
+	srv.Start()
+	defer srv.Close()
+
+	for _, priorKnowledge := range []bool{false, true} {
+		t.Run(fmt.Sprintf("http2-prior-knowledge=%t", priorKnowledge), func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("http2-prior-knowledge", priorKnowledge, "")
+
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			resp, err := client.Get(srv.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if priorKnowledge {
+				assert.Equal(t, "HTTP/2.0", string(body))
+			} else {
+				assert.Equal(t, "HTTP/1.1", string(body))
+			}
+		})
+	}
+}
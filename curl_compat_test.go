@@ -16,6 +16,7 @@ package cobracurl
 
 import (
 	"io"
+	"mime"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -87,6 +88,7 @@ func buildAndRun(t *testing.T, url string, flags map[string]interface{}) {
 	cmd.Flags().String("request", "", "")
 	cmd.Flags().String("url", "", "")
 	cmd.Flags().String("data", "", "")
+	cmd.Flags().StringArray("data-ascii", nil, "")
 	cmd.Flags().String("data-binary", "", "")
 	cmd.Flags().String("data-raw", "", "")
 	cmd.Flags().String("data-urlencode", "", "")
@@ -94,7 +96,11 @@ func buildAndRun(t *testing.T, url string, flags map[string]interface{}) {
 	cmd.Flags().Bool("head", false, "")
 	cmd.Flags().StringArray("header", nil, "")
 	cmd.Flags().StringArray("cookie", nil, "")
-	cmd.Flags().StringToString("form", nil, "")
+	cmd.Flags().StringArray("form", nil, "")
+	cmd.Flags().StringArray("form-string", nil, "")
+	cmd.Flags().Bool("form-escape", false, "")
+	cmd.Flags().String("upload-file", "", "")
+	cmd.Flags().Int64("continue-at", 0, "")
 	cmd.Flags().String("user-agent", "", "")
 	cmd.Flags().String("user", "", "")
 	cmd.Flags().String("oauth2-bearer", "", "")
@@ -134,6 +140,7 @@ func assertRequestsMatch(t *testing.T, curlReq, cobraReq capturedRequest, extraS
 		return alwaysSkipHeaders[h] || extraSkip[h]
 	}
 
+	curlReq, cobraReq = withoutBoundary(curlReq), withoutBoundary(cobraReq)
 	assert.Equal(t, curlReq.Method, cobraReq.Method, "HTTP method")
 	assertBodiesEqual(t, curlReq.Body, cobraReq.Body)
 	assert.Equal(t, curlReq.Cookies, cobraReq.Cookies, "cookies")
@@ -158,6 +165,19 @@ func assertRequestsMatch(t *testing.T, curlReq, cobraReq capturedRequest, extraS
 	}
 }
 
+// withoutBoundary replaces the random multipart boundary of req with a fixed
+// one.
+func withoutBoundary(req capturedRequest) capturedRequest {
+	_, params, err := mime.ParseMediaType(req.Headers.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return req
+	}
+	req.Headers = req.Headers.Clone()
+	req.Headers.Set("Content-Type", strings.ReplaceAll(req.Headers.Get("Content-Type"), params["boundary"], "BOUNDARY"))
+	req.Body = strings.ReplaceAll(req.Body, params["boundary"], "BOUNDARY")
+	return req
+}
+
 func TestCompatWithCurl(t *testing.T) {
 	if _, err := exec.LookPath("curl"); err != nil {
 		t.Skip("curl not found in PATH")
@@ -248,10 +268,24 @@ func TestCompatWithCurl(t *testing.T) {
 		},
 		{
 			name:     "POST with form field",
-			curlArgs: []string{"-d", "field=hello"},
+			curlArgs: []string{"-F", "field=hello"},
 			cobraFlags: map[string]interface{}{
-				"request": "POST",
-				"form":    map[string]string{"field": "hello"},
+				"form": []string{"field=hello"},
+			},
+		},
+		{
+			name:     "POST with form fields and modifiers",
+			curlArgs: []string{"-F", "a=1;type=text/x-a", "-F", `b="x;y";filename=b.txt`, "-F", "c=2;headers=X-C: 3"},
+			cobraFlags: map[string]interface{}{
+				"form": []string{"a=1;type=text/x-a", `b="x;y";filename=b.txt`, "c=2;headers=X-C: 3"},
+			},
+		},
+		{
+			name:     "POST with form-string fields",
+			curlArgs: []string{"--form-string", "a=@not-a-file;type=x", "--form-escape", "--form-string", `q"uo\te=1`},
+			cobraFlags: map[string]interface{}{
+				"form-string": []string{"a=@not-a-file;type=x", `q"uo\te=1`},
+				"form-escape": "true",
 			},
 		},
 		{
@@ -263,6 +297,14 @@ func TestCompatWithCurl(t *testing.T) {
 				"data-raw": "raw body",
 			},
 		},
+		{
+			name:      "POST with data-ascii",
+			curlArgs:  []string{"--data-ascii", "a=1", "--data-ascii", "b=2"},
+			extraSkip: map[string]bool{"Content-Type": true},
+			cobraFlags: map[string]interface{}{
+				"data-ascii": []string{"a=1", "b=2"},
+			},
+		},
 		{
 			name:      "POST with data-binary",
 			curlArgs:  []string{"-X", "POST", "--data-binary", `binary data`},
@@ -272,6 +314,30 @@ func TestCompatWithCurl(t *testing.T) {
 				"data-binary": "binary data",
 			},
 		},
+		{
+			name:      "PUT with upload-file",
+			curlArgs:  []string{"-T", "curl_compat_test.go"},
+			extraSkip: map[string]bool{"Expect": true},
+			cobraFlags: map[string]interface{}{
+				"upload-file": "curl_compat_test.go",
+			},
+		},
+		{
+			name:      "PUT with upload-file resumed at an offset",
+			curlArgs:  []string{"-T", "curl_compat_test.go", "-C", "100"},
+			extraSkip: map[string]bool{"Expect": true},
+			cobraFlags: map[string]interface{}{
+				"upload-file": "curl_compat_test.go",
+				"continue-at": "100",
+			},
+		},
+		{
+			name:     "GET resumed at an offset",
+			curlArgs: []string{"-C", "100"},
+			cobraFlags: map[string]interface{}{
+				"continue-at": "100",
+			},
+		},
 		{
 			name:     "GET with oauth2-bearer token",
 			curlArgs: []string{"-X", "GET", "--oauth2-bearer", "mytoken123"},
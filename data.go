@@ -0,0 +1,571 @@
+package cobracurl
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// dataFlags lists the flags whose values are joined with & into the body.
+var dataFlags = []string{"data", "data-ascii", "data-binary", "data-raw", "data-urlencode"}
+
+// orderedValue is a repeatable flag, such as --data or --form. Values are
+// stamped with a sequence number when set, so that the values of related
+// flags are kept in command-line order. The sequence is shared by the
+// ordered flags of a flag set. It reads as a string flag holding the values
+// joined with sep, or as a stringToString flag for --form, so that
+// GetString and GetStringToString keep working.
+type orderedValue struct {
+	values  []string
+	seqs    []uint64
+	seq     *uint64
+	changed bool
+	sep     string
+	// stringToString makes the value read as a stringToString flag.
+	stringToString bool
+}
+
+// newOrderedValue returns a value sharing the sequence of the ordered flags
+// already registered on flags, reading as a string flag whose values are
+// joined with sep.
+func newOrderedValue(flags *pflag.FlagSet, sep string) *orderedValue {
+	v := &orderedValue{sep: sep}
+	flags.VisitAll(func(f *pflag.Flag) {
+		if other, ok := f.Value.(*orderedValue); ok {
+			v.seq = other.seq
+		}
+	})
+	if v.seq == nil {
+		v.seq = new(uint64)
+	}
+	return v
+}
+
+// newOrderedMapValue is like newOrderedValue, reading as a stringToString
+// flag of name=value pairs.
+func newOrderedMapValue(flags *pflag.FlagSet) *orderedValue {
+	v := newOrderedValue(flags, ",")
+	v.stringToString = true
+	return v
+}
+
+func (v *orderedValue) next() uint64 {
+	*v.seq++
+	return *v.seq
+}
+
+func (v *orderedValue) Set(s string) error {
+	if !v.changed {
+		v.values, v.seqs = nil, nil
+		v.changed = true
+	}
+	v.values = append(v.values, s)
+	v.seqs = append(v.seqs, v.next())
+	return nil
+}
+
+func (v *orderedValue) Append(s string) error {
+	return v.Set(s)
+}
+
+func (v *orderedValue) Replace(values []string) error {
+	v.values, v.seqs = nil, nil
+	for _, s := range values {
+		v.values = append(v.values, s)
+		v.seqs = append(v.seqs, v.next())
+	}
+	return nil
+}
+
+func (v *orderedValue) GetSlice() []string {
+	return slices.Clone(v.values)
+}
+
+func (v *orderedValue) Type() string {
+	if v.stringToString {
+		return "stringToString"
+	}
+	return "string"
+}
+
+func (v *orderedValue) String() string {
+	if !v.stringToString {
+		return strings.Join(v.values, v.sep)
+	}
+	if len(v.values) == 0 {
+		return "[]"
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write(v.values)
+	w.Flush()
+	return "[" + strings.TrimSuffix(b.String(), "\n") + "]"
+}
+
+// flagArg is one value of a repeatable flag.
+type flagArg struct {
+	flag  string
+	value string
+	seq   uint64
+}
+
+// orderedArgs returns the values of the named flags in command-line order.
+// Flags registered by callers as strings, string arrays or string maps are
+// accepted too; their values come in flag order, and map entries are sorted
+// by key.
+func orderedArgs(cmd *cobra.Command, names ...string) []flagArg {
+	var args []flagArg
+	for _, name := range names {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			continue
+		}
+		if v, ok := flag.Value.(*orderedValue); ok {
+			for i, value := range v.values {
+				args = append(args, flagArg{flag: name, value: value, seq: v.seqs[i]})
+			}
+			continue
+		}
+
+		var values []string
+		switch flag.Value.Type() {
+		case "string":
+			if value := flag.Value.String(); value != "" {
+				values = []string{value}
+			}
+		case "stringToString":
+			m, _ := cmd.Flags().GetStringToString(name)
+			for _, key := range slices.Sorted(maps.Keys(m)) {
+				values = append(values, key+"="+m[key])
+			}
+		default:
+			values, _ = cmd.Flags().GetStringArray(name)
+		}
+		for _, value := range values {
+			args = append(args, flagArg{flag: name, value: value})
+		}
+	}
+	slices.SortStableFunc(args, func(a, b flagArg) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return args
+}
+
+// dataArgsBody joins the bodies of args with &, like curl. With --crlf, the
+// line feeds of --data and --data-ascii files are sent as CRLF instead of
+// being stripped.
+func dataArgsBody(cmd *cobra.Command, args []flagArg) (*bodySource, error) {
+	crlf, _ := cmd.Flags().GetBool("crlf")
+	parts := make([]*bodySource, 0, 2*len(args))
+	for i, arg := range args {
+		if i > 0 {
+			parts = append(parts, literalBody("&"))
+		}
+		var part *bodySource
+		var err error
+		switch arg.flag {
+		case "data", "data-ascii":
+			if crlf && strings.HasPrefix(arg.value, "@") {
+				if part, err = dataBody(cmd, arg.value, false); err == nil {
+					part, err = crlfBody(part)
+				}
+			} else {
+				part, err = dataBody(cmd, arg.value, true)
+			}
+		case "data-binary":
+			part, err = dataBody(cmd, arg.value, false)
+		case "data-urlencode":
+			part, err = urlencodeBody(cmd, arg.value)
+		default:
+			part = literalBody(arg.value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return concatBodies(parts), nil
+}
+
+// bodySource is a request body that is opened when the request is built and
+// again for each replay. length is -1 when it is unknown, and open is nil
+// for an empty body. A body read from stdin cannot be reopened and has
+// replayable unset.
+type bodySource struct {
+	open       func() (io.ReadCloser, error)
+	length     int64
+	replayable bool
+}
+
+func literalBody(s string) *bodySource {
+	return &bodySource{
+		open:       func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(s)), nil },
+		length:     int64(len(s)),
+		replayable: true,
+	}
+}
+
+// dataBody returns the body of a --data or --data-binary value. Like curl,
+// a value starting with @ names a file to read, or stdin for @-. --data
+// strips carriage returns and newlines from the content, which --data-binary
+// keeps.
+func dataBody(cmd *cobra.Command, value string, stripNewlines bool) (*bodySource, error) {
+	path, ok := strings.CutPrefix(value, "@")
+	if !ok {
+		return literalBody(value), nil
+	}
+	return fileBody(cmd, path, stripNewlines)
+}
+
+// urlencodeBody returns the body of a --data-urlencode value, in one of
+// curl's forms:
+//
+//	content       content is URL-encoded
+//	=content      content is URL-encoded, without the leading =
+//	name=content  content is URL-encoded, name is sent as is
+//	@file         the content of file (or stdin for -) is URL-encoded
+//	name@file     the content of file is URL-encoded, after name=
+//
+// The name ends at the first =, or else at the first @.
+func urlencodeBody(cmd *cobra.Command, value string) (*bodySource, error) {
+	sep := strings.IndexByte(value, '=')
+	if sep < 0 {
+		sep = strings.IndexByte(value, '@')
+	}
+	if sep < 0 {
+		return literalBody(escapeUnreserved(value)), nil
+	}
+
+	name, content := value[:sep], value[sep+1:]
+	if value[sep] == '@' {
+		file, err := fileBody(cmd, content, false)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = file.String(); err != nil {
+			return nil, err
+		}
+	}
+	if name == "" {
+		return literalBody(escapeUnreserved(content)), nil
+	}
+	return literalBody(name + "=" + escapeUnreserved(content)), nil
+}
+
+// escapeUnreserved percent-encodes every byte except RFC 3986 unreserved
+// characters, with upper-case hex digits, as curl_easy_escape and AWS
+// Signature Version 4 do. Spaces become %20.
+func escapeUnreserved(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// fileBody streams the content of path, or of stdin when path is "-". Regular
+// files are reopened for replays and their length is known up front, counted
+// once more when newlines are stripped.
+func fileBody(cmd *cobra.Command, path string, stripNewlines bool) (*bodySource, error) {
+	filter := func(r io.ReadCloser) io.ReadCloser { return r }
+	if stripNewlines {
+		filter = func(r io.ReadCloser) io.ReadCloser {
+			return readCloser{Reader: &newlineStripper{r: r}, Closer: r}
+		}
+	}
+
+	if path == "-" {
+		stdin := io.NopCloser(cmd.InOrStdin())
+		return &bodySource{
+			open:   func() (io.ReadCloser, error) { return filter(stdin), nil },
+			length: -1,
+		}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading data file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading data file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		// Pipes and devices are read once, like stdin.
+		return &bodySource{
+			open:   func() (io.ReadCloser, error) { return filter(f), nil },
+			length: -1,
+		}, nil
+	}
+
+	length := info.Size()
+	if stripNewlines {
+		length, err = io.Copy(io.Discard, &newlineStripper{r: f})
+	}
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading data file: %w", err)
+	}
+
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading data file: %w", err)
+			}
+			return filter(f), nil
+		},
+		length:     length,
+		replayable: true,
+	}, nil
+}
+
+// concatBodies returns a body sending parts one after the other.
+func concatBodies(parts []*bodySource) *bodySource {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	body := &bodySource{replayable: true}
+	for _, part := range parts {
+		if body.length >= 0 {
+			if part.length < 0 {
+				body.length = -1
+			} else {
+				body.length += part.length
+			}
+		}
+		body.replayable = body.replayable && part.replayable
+	}
+	body.open = func() (io.ReadCloser, error) {
+		readers := make([]io.Reader, 0, len(parts))
+		closers := make([]io.Closer, 0, len(parts))
+		for _, part := range parts {
+			if part.open == nil {
+				continue
+			}
+			r, err := part.open()
+			if err != nil {
+				closeAll(closers)
+				return nil, err
+			}
+			readers = append(readers, r)
+			closers = append(closers, r)
+		}
+		return readCloser{Reader: io.MultiReader(readers...), Closer: closerFunc(func() error { return closeAll(closers) })}, nil
+	}
+	return body
+}
+
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for _, c := range closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// String reads the whole body, for --get which sends it in the query.
+func (b *bodySource) String() (string, error) {
+	if b.open == nil {
+		return "", nil
+	}
+	r, err := b.open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	return string(data), err
+}
+
+// attach sets the body of req, with its length and, when the body can be
+// reopened, GetBody so that net/http and the auth transports can replay it.
+func (b *bodySource) attach(req *http.Request) error {
+	if b.open == nil || b.length == 0 {
+		req.Body, req.GetBody, req.ContentLength = http.NoBody, nil, 0
+		return nil
+	}
+	body, err := b.open()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	req.ContentLength = b.length
+	req.GetBody = nil
+	if b.replayable {
+		req.GetBody = b.open
+	}
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// ErrBodyChanged is returned while sending a --crlf body whose length,
+// counted when the request was built, no longer matches its content.
+var ErrBodyChanged = errors.New("request body changed since it was read")
+
+// crlfBody converts each line feed of body to CRLF while streaming, like
+// curl's --crlf. To know the Content-Length, a body that can be reopened is
+// read once more up front to count its line feeds; each send then checks
+// that the converted content still has that length.
+func crlfBody(body *bodySource) (*bodySource, error) {
+	if body.open == nil {
+		return body, nil
+	}
+
+	length := int64(-1)
+	if body.length >= 0 && body.replayable {
+		r, err := body.open()
+		if err != nil {
+			return nil, err
+		}
+		lineFeeds, err := countLineFeeds(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading data file: %w", err)
+		}
+		length = body.length + lineFeeds
+	}
+
+	open := body.open
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			r, err := open()
+			if err != nil {
+				return nil, err
+			}
+			var converted io.Reader = &crlfConverter{r: r}
+			if length >= 0 {
+				converted = &lengthChecker{r: converted, remaining: length}
+			}
+			return readCloser{Reader: converted, Closer: r}, nil
+		},
+		length:     length,
+		replayable: body.replayable,
+	}, nil
+}
+
+func countLineFeeds(r io.Reader) (int64, error) {
+	var count int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		count += int64(bytes.Count(buf[:n], []byte("\n")))
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// lengthChecker fails with ErrBodyChanged when its reader does not return
+// exactly remaining bytes.
+type lengthChecker struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (c *lengthChecker) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining < 0 || err == io.EOF && c.remaining > 0 {
+		return n, ErrBodyChanged
+	}
+	return n, err
+}
+
+// crlfConverter writes a carriage return before each line feed it reads.
+// Every line feed is converted, even one already preceded by a carriage
+// return, as curl does.
+type crlfConverter struct {
+	r         io.Reader
+	buf       []byte
+	pendingLF bool
+}
+
+func (c *crlfConverter) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := 0
+	if c.pendingLF {
+		p[0] = '\n'
+		n, c.pendingLF = 1, false
+		if len(p) == 1 {
+			return n, nil
+		}
+	}
+
+	// Read at most half of the room left, so that every byte fits once
+	// converted. A single byte of room holds the CR of a line feed, whose LF
+	// is then returned by the next Read.
+	room := max((len(p)-n)/2, 1)
+	if cap(c.buf) < room {
+		c.buf = make([]byte, room)
+	}
+	m, err := c.r.Read(c.buf[:room])
+	for _, b := range c.buf[:m] {
+		if b == '\n' {
+			p[n] = '\r'
+			n++
+			if n == len(p) {
+				c.pendingLF = true
+				break
+			}
+		}
+		p[n] = b
+		n++
+	}
+	if c.pendingLF && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// newlineStripper drops carriage returns and newlines while reading.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (s *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		kept := p[:0]
+		for _, c := range p[:n] {
+			if c != '\r' && c != '\n' {
+				kept = append(kept, c)
+			}
+		}
+		if len(kept) > 0 || err != nil {
+			return len(kept), err
+		}
+	}
+}
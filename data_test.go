@@ -0,0 +1,369 @@
+package cobracurl
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRequestDataFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a=1\r\n&b=2\n"), 0o600))
+
+	tests := []struct {
+		name           string
+		flag           string
+		value          string
+		stdin          string
+		expectedBody   string
+		expectedLength int64
+		replayable     bool
+	}{
+		{
+			name:           "--data strips newlines from a file",
+			flag:           "data",
+			value:          "@" + path,
+			expectedBody:   "a=1&b=2",
+			expectedLength: 7,
+			replayable:     true,
+		},
+		{
+			name:           "--data-ascii strips newlines from a file",
+			flag:           "data-ascii",
+			value:          "@" + path,
+			expectedBody:   "a=1&b=2",
+			expectedLength: 7,
+			replayable:     true,
+		},
+		{
+			name:           "--data-binary keeps the file bytes",
+			flag:           "data-binary",
+			value:          "@" + path,
+			expectedBody:   "a=1\r\n&b=2\n",
+			expectedLength: 10,
+			replayable:     true,
+		},
+		{
+			name:           "--data-raw stays literal",
+			flag:           "data-raw",
+			value:          "@" + path,
+			expectedBody:   "@" + path,
+			expectedLength: int64(len(path) + 1),
+			replayable:     true,
+		},
+		{
+			name:           "--data reads stdin",
+			flag:           "data",
+			value:          "@-",
+			stdin:          "x=1\ny=2\n",
+			expectedBody:   "x=1y=2",
+			expectedLength: -1,
+		},
+		{
+			name:           "--data-binary reads stdin",
+			flag:           "data-binary",
+			value:          "@-",
+			stdin:          "x=1\ny=2\n",
+			expectedBody:   "x=1\ny=2\n",
+			expectedLength: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetIn(strings.NewReader(tt.stdin))
+			cmd.Flags().String("url", "http://example.com", "")
+			cmd.Flags().String(tt.flag, tt.value, "")
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, http.MethodPost, req.Method)
+			assert.Equal(t, tt.expectedLength, req.ContentLength)
+
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+
+			if !tt.replayable {
+				assert.Nil(t, req.GetBody)
+				return
+			}
+			require.NotNil(t, req.GetBody)
+			replay, err := req.GetBody()
+			require.NoError(t, err)
+			body, err = io.ReadAll(replay)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestBuildRequestDataFromMissingFile(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().String("data", "@"+filepath.Join(t.TempDir(), "missing"), "")
+
+	_, err := BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBuildRequestDataFromFileWithGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "query.txt")
+	require.NoError(t, os.WriteFile(path, []byte("q=1\n"), 0o600))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com/search", "")
+	cmd.Flags().String("data", "@"+path, "")
+	cmd.Flags().Bool("get", true, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/search?q=1", req.URL.String())
+	assert.Equal(t, http.NoBody, req.Body)
+}
+
+func TestBuildRequestDataFromFileSent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.bin")
+	content := strings.Repeat("0123456789", 100_000)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, int64(len(content)), r.ContentLength)
+		assert.Equal(t, content, string(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", srv.URL, "")
+	cmd.Flags().String("data-binary", "@"+path, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestBuildRequestRepeatedData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.txt")
+	require.NoError(t, os.WriteFile(path, []byte("file=1\n"), 0o600))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	RegisterBodyFlags(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{
+		"-d", "a=1",
+		"--data-raw", "@raw",
+		"--data-binary", "@" + path,
+		"-d", "b=2",
+		"--data-urlencode", "c=x",
+		"--data-ascii", "d=4",
+	}))
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1&@raw&file=1\n&b=2&c=x&d=4", string(body))
+	assert.Equal(t, int64(len(body)), req.ContentLength)
+
+	value, err := cmd.Flags().GetString("data")
+	require.NoError(t, err)
+	assert.Equal(t, "a=1&b=2", value)
+}
+
+func TestOrderedValueReadsAsPreviousType(t *testing.T) {
+	cmd := &cobra.Command{}
+	RegisterBodyFlags(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{
+		"-F", "a=1",
+		"-F", "file=@path",
+		"--form-string", "b=2",
+		"--json", `{"c":`,
+		"--json", "3}",
+	}))
+
+	form, err := cmd.Flags().GetStringToString("form")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "file": "@path"}, form)
+
+	formString, err := cmd.Flags().GetString("form-string")
+	require.NoError(t, err)
+	assert.Equal(t, "b=2", formString)
+
+	json, err := cmd.Flags().GetString("json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"c":3}`, json)
+
+	dataRaw, err := cmd.Flags().GetString("data-raw")
+	require.NoError(t, err)
+	assert.Empty(t, dataRaw)
+}
+
+func TestOrderedValueSequencePerFlagSet(t *testing.T) {
+	first := &cobra.Command{}
+	RegisterBodyFlags(first.Flags())
+	second := &cobra.Command{}
+	RegisterBodyFlags(second.Flags())
+
+	require.NoError(t, first.Flags().Parse([]string{"--json", "1", "-d", "a"}))
+	require.NoError(t, second.Flags().Parse([]string{"-d", "b", "--json", "2"}))
+	require.NoError(t, first.Flags().Parse([]string{"-d", "c"}))
+
+	assert.Equal(t, []flagArg{
+		{flag: "json", value: "1", seq: 1},
+		{flag: "data", value: "a", seq: 2},
+		{flag: "data", value: "c", seq: 3},
+	}, orderedArgs(first, "data", "json"))
+	assert.Equal(t, []flagArg{
+		{flag: "data", value: "b", seq: 1},
+		{flag: "json", value: "2", seq: 2},
+	}, orderedArgs(second, "data", "json"))
+}
+
+func TestBuildRequestDataStringArrayFlags(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().StringArray("data", []string{"a=1", "b=2"}, "")
+	cmd.Flags().String("data-raw", "c=3", "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1&b=2&c=3", string(body))
+}
+
+func TestBuildRequestDataURLEncode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a b+c/d\n"), 0o600))
+
+	tests := []struct {
+		value        string
+		stdin        string
+		expectedBody string
+	}{
+		{value: "hello world", expectedBody: "hello%20world"},
+		{value: "=a=b&c", expectedBody: "a%3Db%26c"},
+		{value: "grant_type=client credentials~.-_", expectedBody: "grant_type=client%20credentials~.-_"},
+		{value: "na me=ü", expectedBody: "na me=%C3%BC"},
+		{value: "@" + path, expectedBody: "a%20b%2Bc%2Fd%0A"},
+		{value: "token@" + path, expectedBody: "token=a%20b%2Bc%2Fd%0A"},
+		{value: "token@-", stdin: "x y", expectedBody: "token=x%20y"},
+		{value: "user@example.com=x", expectedBody: "user@example.com=x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetIn(strings.NewReader(tt.stdin))
+			cmd.Flags().String("url", "http://example.com", "")
+			cmd.Flags().String("data-urlencode", tt.value, "")
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestCRLFConverter(t *testing.T) {
+	for _, input := range []string{"", "no newline", "a\nb\r\nc\n", "\n\n\n", strings.Repeat("line\n", 10_000)} {
+		expected := strings.ReplaceAll(input, "\n", "\r\n")
+
+		converted, err := io.ReadAll(&crlfConverter{r: strings.NewReader(input)})
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(converted))
+
+		// One byte at a time, the LF of a line feed comes in the next Read.
+		var out bytes.Buffer
+		r := &crlfConverter{r: iotest.OneByteReader(strings.NewReader(input))}
+		p := make([]byte, 1)
+		for {
+			n, err := r.Read(p)
+			out.Write(p[:n])
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+		}
+		assert.Equal(t, expected, out.String())
+	}
+}
+
+func TestBuildRequestDataCRLF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\r\nc\n"), 0o600))
+
+	tests := []struct {
+		name           string
+		flag           string
+		value          string
+		stdin          string
+		expectedBody   string
+		expectedLength int64
+	}{
+		{name: "--data file", flag: "data", value: "@" + path, expectedBody: "a\r\nb\r\r\nc\r\n", expectedLength: 10},
+		{name: "--data stdin", flag: "data", value: "@-", stdin: "x\ny", expectedBody: "x\r\ny", expectedLength: -1},
+		{name: "--data literal", flag: "data", value: "a\nb", expectedBody: "a\nb", expectedLength: 3},
+		{name: "--data-ascii file", flag: "data-ascii", value: "@" + path, expectedBody: "a\r\nb\r\r\nc\r\n", expectedLength: 10},
+		{name: "--data-binary file", flag: "data-binary", value: "@" + path, expectedBody: "a\nb\r\nc\n", expectedLength: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetIn(strings.NewReader(tt.stdin))
+			cmd.Flags().String("url", "http://example.com", "")
+			cmd.Flags().Bool("crlf", true, "")
+			cmd.Flags().String(tt.flag, tt.value, "")
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLength, req.ContentLength)
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestBuildRequestDataCRLFChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\nc\n"), 0o600))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().Bool("crlf", true, "")
+	cmd.Flags().String("data", "@"+path, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), req.ContentLength)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "a\r\nb\r\nc\r\n", string(body))
+
+	for _, content := range []string{"a\n\n\n\n\n\n", "abcdef"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		replay, err := req.GetBody()
+		require.NoError(t, err)
+		_, err = io.ReadAll(replay)
+		assert.ErrorIs(t, err, ErrBodyChanged, content)
+	}
+}
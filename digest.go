@@ -0,0 +1,266 @@
+package cobracurl
+
+import (
+	"crypto/md5" //nolint:gosec // MD5 is the default Digest algorithm
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type digestAlgorithm struct {
+	name string
+	hash func() hash.Hash
+}
+
+// digestAlgorithms lists the supported Digest algorithms, strongest first.
+var digestAlgorithms = []digestAlgorithm{
+	{"SHA-512-256", sha512.New512_256},
+	{"SHA-256", sha256.New},
+	{"MD5", md5.New},
+}
+
+// digestChallenge is a Digest challenge (RFC 7616) together with the nonce
+// count used so far, so that later requests can answer it preemptively.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	hash      func() hash.Hash
+	sess      bool
+	nc        uint32
+}
+
+// newDigestChallenge returns the strongest supported Digest challenge, or
+// nil when there is none.
+func newDigestChallenge(challenges []authChallenge) *digestChallenge {
+	var best *digestChallenge
+	bestRank := len(digestAlgorithms)
+	for _, c := range challenges {
+		if !strings.EqualFold(c.Scheme, "Digest") || c.Params["nonce"] == "" {
+			continue
+		}
+
+		algorithm := c.Params["algorithm"]
+		name, sess := strings.CutSuffix(strings.ToUpper(algorithm), "-SESS")
+		if algorithm == "" {
+			name = "MD5"
+		}
+		rank := slices.IndexFunc(digestAlgorithms, func(a digestAlgorithm) bool { return a.name == name })
+		if rank < 0 || rank >= bestRank {
+			continue
+		}
+
+		var qop string
+		if c.Params["qop"] != "" {
+			offered := strings.Split(c.Params["qop"], ",")
+			for i := range offered {
+				offered[i] = strings.TrimSpace(offered[i])
+			}
+			switch {
+			case slices.Contains(offered, "auth"):
+				qop = "auth"
+			case slices.Contains(offered, "auth-int"):
+				qop = "auth-int"
+			default:
+				continue
+			}
+		}
+
+		bestRank = rank
+		best = &digestChallenge{
+			realm:     c.Params["realm"],
+			nonce:     c.Params["nonce"],
+			opaque:    c.Params["opaque"],
+			algorithm: algorithm,
+			qop:       qop,
+			userhash:  strings.EqualFold(c.Params["userhash"], "true"),
+			hash:      digestAlgorithms[rank].hash,
+			sess:      sess,
+		}
+	}
+	return best
+}
+
+func (c *digestChallenge) h(parts ...string) string {
+	h := c.hash()
+	_, _ = io.WriteString(h, strings.Join(parts, ":"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorization computes the Authorization header value for a request with
+// the given method, request target and body, using nonce count nc.
+func (c *digestChallenge) authorization(username, password, method, uri string, body []byte, cnonce string, nc uint32) string {
+	ha1 := c.h(username, c.realm, password)
+	if c.sess {
+		ha1 = c.h(ha1, c.nonce, cnonce)
+	}
+
+	ha2 := c.h(method, uri)
+	if c.qop == "auth-int" {
+		h := c.hash()
+		h.Write(body)
+		ha2 = c.h(method, uri, hex.EncodeToString(h.Sum(nil)))
+	}
+
+	ncValue := fmt.Sprintf("%08x", nc)
+	var response string
+	if c.qop == "" {
+		response = c.h(ha1, c.nonce, ha2)
+	} else {
+		response = c.h(ha1, c.nonce, ncValue, cnonce, c.qop, ha2)
+	}
+
+	if c.userhash {
+		username = c.h(username, c.realm)
+	}
+
+	params := []string{
+		"username=" + quoteParam(username),
+		"realm=" + quoteParam(c.realm),
+		"nonce=" + quoteParam(c.nonce),
+		"uri=" + quoteParam(uri),
+	}
+	if c.algorithm != "" {
+		params = append(params, "algorithm="+c.algorithm)
+	}
+	if c.qop != "" {
+		params = append(params, "qop="+c.qop, "nc="+ncValue, "cnonce="+quoteParam(cnonce))
+	}
+	params = append(params, "response="+quoteParam(response))
+	if c.opaque != "" {
+		params = append(params, "opaque="+quoteParam(c.opaque))
+	}
+	if c.userhash {
+		params = append(params, "userhash=true")
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+func quoteParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// digestTransport answers Digest challenges by replaying the request with
+// an Authorization header. The last challenge of each host is reused for
+// later requests, so they are sent with credentials right away.
+type digestTransport struct {
+	credentials credentialsFunc
+	trusted     bool
+	next        http.RoundTripper
+	// cnonce generates client nonces; tests replace it.
+	cnonce func() string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+func newDigestTransport(credentials credentialsFunc, trusted bool, next http.RoundTripper) *digestTransport {
+	return &digestTransport{
+		credentials: credentials,
+		trusted:     trusted,
+		next:        next,
+		cnonce:      randomCnonce,
+		challenges:  map[string]*digestChallenge{},
+	}
+}
+
+func randomCnonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	username, password, ok := t.credentials(req.URL)
+	if !ok || !authAllowed(req, t.trusted) {
+		return t.next.RoundTrip(req)
+	}
+
+	req, err := replayableRequest(withoutUserinfo(req))
+	if err != nil {
+		return nil, err
+	}
+
+	host := req.URL.Host
+	t.mu.Lock()
+	challenge := t.challenges[host]
+	t.mu.Unlock()
+
+	first := req
+	if challenge != nil {
+		if first, err = t.authorize(req, challenge, username, password); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := t.next.RoundTrip(first)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge = newDigestChallenge(parseAuthChallenges(resp.Header.Values("WWW-Authenticate")))
+	if challenge == nil {
+		return resp, nil
+	}
+	discardResponse(resp)
+
+	t.setChallenge(host, challenge)
+
+	retry, err := rewindBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if retry, err = t.authorize(retry, challenge, username, password); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(retry)
+}
+
+// setChallenge stores the challenge to answer for requests to host.
+func (t *digestTransport) setChallenge(host string, challenge *digestChallenge) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.challenges[host] = challenge
+}
+
+// authorize returns a copy of req carrying the Digest answer to challenge.
+func (t *digestTransport) authorize(req *http.Request, challenge *digestChallenge, username, password string) (*http.Request, error) {
+	var body []byte
+	if challenge.qop == "auth-int" && req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	challenge.nc++
+	nc := challenge.nc
+	t.mu.Unlock()
+
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", challenge.authorization(
+		username, password, req.Method, req.URL.RequestURI(), body, t.cnonce(), nc))
+	return authorized, nil
+}
+
+func (t *digestTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
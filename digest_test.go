@@ -0,0 +1,159 @@
+package cobracurl
+
+import (
+	"crypto/md5" //nolint:gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestAuthorizationRFC7616(t *testing.T) {
+	// Examples of RFC 7616 section 3.9.1.
+	const header = `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, ` +
+		`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+
+	tests := []struct {
+		algorithm        string
+		expectedResponse string
+	}{
+		{algorithm: "MD5", expectedResponse: "8ca523f5e9506fed4657c9700eebdbec"},
+		{algorithm: "SHA-256", expectedResponse: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			challenge := newDigestChallenge(parseAuthChallenges([]string{strings.Replace(header, "%s", tt.algorithm, 1)}))
+			require.NotNil(t, challenge)
+
+			authorization := challenge.authorization("Mufasa", "Circle of Life", http.MethodGet, "/dir/index.html", nil,
+				"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", 1)
+			assert.Equal(t, `Digest username="Mufasa", realm="http-auth@example.org", `+
+				`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", algorithm=`+tt.algorithm+`, `+
+				`qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", `+
+				`response="`+tt.expectedResponse+`", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`, authorization)
+		})
+	}
+}
+
+func TestNewDigestChallengePrefersStrongestAlgorithm(t *testing.T) {
+	challenge := newDigestChallenge(parseAuthChallenges([]string{
+		`Basic realm="x", Digest realm="x", nonce="n1", algorithm=MD5`,
+		`Digest realm="x", nonce="n2", algorithm=SHA-256-sess, qop="auth-int", Digest realm="x", nonce="n3", algorithm=unknown`,
+	}))
+	require.NotNil(t, challenge)
+	assert.Equal(t, "n2", challenge.nonce)
+	assert.True(t, challenge.sess)
+	assert.Equal(t, "auth-int", challenge.qop)
+
+	assert.Nil(t, newDigestChallenge(parseAuthChallenges([]string{`Basic realm="x"`})))
+}
+
+// newDigestServer answers requests without valid Digest credentials for
+// user:secret with a challenge for algorithm and qop.
+func newDigestServer(t *testing.T, algorithm, qop string) *httptest.Server {
+	t.Helper()
+	const realm, nonce = "test", "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+
+	newHash := func() hash.Hash { return md5.New() } //nolint:gosec
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		_, _ = io.WriteString(sum, s)
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		challenges := parseAuthChallenges(r.Header.Values("Authorization"))
+		if len(challenges) == 1 {
+			p := challenges[0].Params
+			ha1 := h("user:" + realm + ":secret")
+			if strings.HasSuffix(algorithm, "-sess") {
+				ha1 = h(ha1 + ":" + nonce + ":" + p["cnonce"])
+			}
+			ha2 := h(r.Method + ":" + p["uri"])
+			if qop == "auth-int" {
+				ha2 = h(r.Method + ":" + p["uri"] + ":" + h(string(body)))
+			}
+			expected := h(ha1 + ":" + nonce + ":" + p["nc"] + ":" + p["cnonce"] + ":" + qop + ":" + ha2)
+			if p["response"] == expected && p["uri"] == r.RequestURI {
+				_, _ = w.Write([]byte("authenticated " + p["nc"] + " " + string(body)))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="`+realm+`", nonce="`+nonce+`", algorithm=`+algorithm+`, qop="`+qop+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBuildClientDigest(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		qop       string
+	}{
+		{algorithm: "MD5", qop: "auth"},
+		{algorithm: "MD5-sess", qop: "auth"},
+		{algorithm: "SHA-256", qop: "auth"},
+		{algorithm: "SHA-256-sess", qop: "auth-int"},
+		{algorithm: "MD5", qop: "auth-int"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm+" "+tt.qop, func(t *testing.T) {
+			srv := newDigestServer(t, tt.algorithm, tt.qop)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", srv.URL+"/dir/index.html?q=1", "")
+			cmd.Flags().String("user", "user:secret", "")
+			cmd.Flags().Bool("digest", true, "")
+			cmd.Flags().String("data", "payload", "")
+
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			for _, expected := range []string{"authenticated 00000001 payload", "authenticated 00000002 payload"} {
+				req, err := BuildRequest(cmd, nil)
+				require.NoError(t, err)
+				assert.Empty(t, req.Header.Get("Authorization"))
+
+				resp, err := client.Do(req)
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				require.NoError(t, err)
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, expected, string(body))
+			}
+		})
+	}
+}
+
+func TestBuildClientDigestWrongPassword(t *testing.T) {
+	srv := newDigestServer(t, "MD5", "auth")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("user", "user:wrong", "")
+	cmd.Flags().Bool("digest", true, "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
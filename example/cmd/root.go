@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"io"
-	"net/http"
 
 	"github.com/cerberauth/cobracurl"
 	"github.com/spf13/cobra"
@@ -18,13 +17,26 @@ var rootCmd = &cobra.Command{
 			return err
 		}
 
-		client := &http.Client{}
+		client, err := cobracurl.BuildClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		rec := &cobracurl.RedirectRecorder{}
+		req = req.WithContext(cobracurl.WithRedirectRecorder(req.Context(), rec))
+
 		resp, err := client.Do(req)
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
 
+		if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+			for _, hop := range rec.Hops() {
+				fmt.Fprintf(cmd.ErrOrStderr(), "* %d %s -> %s (%s)\n", hop.StatusCode, hop.URL, hop.Location, hop.Duration)
+			}
+		}
+
 		body, _ := io.ReadAll(resp.Body)
 		fmt.Println("Response:", string(body))
 		return nil
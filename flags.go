@@ -245,7 +245,7 @@ func RegisterLocationTrustedFlag(flags *pflag.FlagSet) {
 }
 
 func RegisterMaxRedirsFlag(flags *pflag.FlagSet) {
-	flags.Int("max-redirs", 30, "Maximum number of redirects allowed")
+	flags.Int("max-redirs", DefaultMaxRedirs, "Maximum number of redirects allowed, -1 for unlimited")
 }
 
 func RegisterPost301Flag(flags *pflag.FlagSet) {
@@ -493,7 +493,7 @@ func RegisterAppendFlag(flags *pflag.FlagSet) {
 }
 
 func RegisterContinueAtFlag(flags *pflag.FlagSet) {
-	flags.Int64P("continue-at", "C", 0, "Resumed transfer offset")
+	flags.VarP(new(continueAtValue), "continue-at", "C", "Resumed transfer offset")
 }
 
 func RegisterCrlfFlag(flags *pflag.FlagSet) {
@@ -501,27 +501,27 @@ func RegisterCrlfFlag(flags *pflag.FlagSet) {
 }
 
 func RegisterDataFlag(flags *pflag.FlagSet) {
-	flags.StringP("data", "d", "", "HTTP POST data")
+	flags.VarP(newOrderedValue(flags, "&"), "data", "d", "HTTP POST data")
 }
 
 func RegisterDataAsciiFlag(flags *pflag.FlagSet) {
-	flags.String("data-ascii", "", "HTTP POST ASCII data")
+	flags.Var(newOrderedValue(flags, "&"), "data-ascii", "HTTP POST ASCII data")
 }
 
 func RegisterDataBinaryFlag(flags *pflag.FlagSet) {
-	flags.String("data-binary", "", "HTTP POST binary data")
+	flags.Var(newOrderedValue(flags, "&"), "data-binary", "HTTP POST binary data")
 }
 
 func RegisterDataRawFlag(flags *pflag.FlagSet) {
-	flags.String("data-raw", "", "HTTP POST data, @ is not special")
+	flags.Var(newOrderedValue(flags, "&"), "data-raw", "HTTP POST data, @ is not special")
 }
 
 func RegisterDataUrlencodeFlag(flags *pflag.FlagSet) {
-	flags.String("data-urlencode", "", "HTTP POST data URL encoded")
+	flags.Var(newOrderedValue(flags, "&"), "data-urlencode", "HTTP POST data URL encoded")
 }
 
 func RegisterFormFlag(flags *pflag.FlagSet) {
-	flags.StringToStringP("form", "F", map[string]string{}, "Specify multipart MIME data")
+	flags.VarP(newOrderedMapValue(flags), "form", "F", "Specify multipart MIME data")
 }
 
 func RegisterFormEscapeFlag(flags *pflag.FlagSet) {
@@ -529,11 +529,11 @@ func RegisterFormEscapeFlag(flags *pflag.FlagSet) {
 }
 
 func RegisterFormStringFlag(flags *pflag.FlagSet) {
-	flags.String("form-string", "", "Specify multipart MIME data")
+	flags.Var(newOrderedValue(flags, ","), "form-string", "Specify multipart MIME data")
 }
 
 func RegisterJsonFlag(flags *pflag.FlagSet) {
-	flags.String("json", "", "HTTP POST JSON")
+	flags.Var(newOrderedValue(flags, ""), "json", "HTTP POST JSON")
 }
 
 func RegisterUploadFileFlag(flags *pflag.FlagSet) {
@@ -0,0 +1,421 @@
+package cobracurl
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ErrInvalidFormField is returned for a --form value that cannot be parsed.
+var ErrInvalidFormField = errors.New("invalid form field")
+
+// formFlags lists the flags whose values are the parts of a multipart body.
+var formFlags = []string{"form", "form-string"}
+
+// formArgsBody returns the multipart/form-data body of the --form and
+// --form-string values in args, and its boundary. --form-string values are
+// literal name=value fields, without @, < or modifiers.
+func formArgsBody(cmd *cobra.Command, args []flagArg) (*bodySource, string, error) {
+	parts := make([]formPart, 0, len(args))
+	for _, arg := range args {
+		if arg.flag == "form-string" {
+			name, value, ok := strings.Cut(arg.value, "=")
+			if !ok || name == "" {
+				return nil, "", fmt.Errorf("%w: %q", ErrInvalidFormField, arg.value)
+			}
+			parts = append(parts, formPart{name: name, value: value})
+			continue
+		}
+		part, err := parseFormField(arg.value)
+		if err != nil {
+			return nil, "", err
+		}
+		parts = append(parts, part)
+	}
+	escape, _ := cmd.Flags().GetBool("form-escape")
+	return formBody(cmd, parts, escape)
+}
+
+// formContentTypes are the Content-Types curl derives from file name
+// extensions.
+var formContentTypes = map[string]string{
+	".gif":  "image/gif",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".txt":  "text/plain",
+	".htm":  "text/html",
+	".html": "text/html",
+	".pdf":  "application/pdf",
+	".xml":  "application/xml",
+}
+
+// formPart is one part of a multipart/form-data body.
+type formPart struct {
+	name        string
+	value       string
+	path        string
+	upload      bool
+	filename    string
+	hasFilename bool
+	contentType string
+	headers     []string
+	encoder     string
+}
+
+// parseFormField parses a --form value in curl's syntax:
+//
+//	name=content        a text field
+//	name=<file          a field holding the content of file
+//	name=@file          a file upload, named after file
+//
+// followed by ;type=, ;filename=, ;headers= (or ;headers=@file) and
+// ;encoder= modifiers. Values may be double-quoted to hold a ;. Like curl,
+// @- and <- read stdin.
+func parseFormField(spec string) (formPart, error) {
+	name, rest, ok := strings.Cut(spec, "=")
+	if !ok || name == "" {
+		return formPart{}, fmt.Errorf("%w: %q", ErrInvalidFormField, spec)
+	}
+	part := formPart{name: name}
+
+	if rest != "" && (rest[0] == '@' || rest[0] == '<') {
+		part.upload = rest[0] == '@'
+		if part.path, rest = formWord(rest[1:]); part.path == "" {
+			return formPart{}, fmt.Errorf("%w: %q: missing file name", ErrInvalidFormField, spec)
+		}
+	} else {
+		part.value, rest = formWord(rest)
+	}
+	if part.upload {
+		part.filename, part.hasFilename = filepath.Base(part.path), true
+	}
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest[1:], " \t")
+		end := strings.IndexAny(rest, "=;")
+		// curl skips modifiers without a value.
+		if end < 0 {
+			break
+		}
+		if rest[end] == ';' {
+			rest = rest[end:]
+			continue
+		}
+		key, value := rest[:end], rest[end+1:]
+		switch strings.ToLower(key) {
+		case "type":
+			part.contentType, rest = formTypeWord(value)
+		case "filename":
+			part.filename, rest = formWord(value)
+			part.hasFilename = true
+		case "headers":
+			var header string
+			header, rest = formWord(value)
+			if path, ok := strings.CutPrefix(header, "@"); ok {
+				headers, err := readFormHeaders(path)
+				if err != nil {
+					return formPart{}, err
+				}
+				part.headers = append(part.headers, headers...)
+			} else {
+				part.headers = append(part.headers, header)
+			}
+		case "encoder":
+			part.encoder, rest = formWord(value)
+			switch part.encoder {
+			case "binary", "8bit", "7bit", "base64", "quoted-printable":
+			default:
+				return formPart{}, fmt.Errorf("%w: %q: unknown encoder %q", ErrInvalidFormField, spec, part.encoder)
+			}
+		default:
+			// curl warns about and skips unknown modifiers.
+			_, rest = formWord(value)
+		}
+	}
+	return part, nil
+}
+
+// formWord reads a modifier value up to the next ;, or a double-quoted value
+// with backslash escapes. rest starts at the ; that ends it, if any.
+func formWord(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		if i := strings.IndexByte(s, ';'); i >= 0 {
+			return s[:i], s[i:]
+		}
+		return s, ""
+	}
+
+	var b strings.Builder
+	i := 1
+	for ; i < len(s) && s[i] != '"'; i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	if i >= len(s) {
+		// An unterminated quote is taken literally.
+		return formWord(s[1:])
+	}
+	rest := s[i+1:]
+	if j := strings.IndexByte(rest, ';'); j >= 0 {
+		return b.String(), rest[j:]
+	}
+	return b.String(), ""
+}
+
+// formTypeWord reads a ;type= value, which like in curl may hold parameters
+// such as "text/plain; charset=utf-8": a ; followed by a space does not end
+// it.
+func formTypeWord(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		return formWord(s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ';' && (i+1 == len(s) || s[i+1] != ' ' && s[i+1] != '\t') {
+			return s[:i], s[i:]
+		}
+	}
+	return s, ""
+}
+
+// readFormHeaders reads the headers of a ;headers=@file modifier, one per
+// line, skipping blank lines and # comments.
+func readFormHeaders(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading form headers: %w", err)
+	}
+	defer f.Close()
+
+	var headers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		headers = append(headers, line)
+	}
+	return headers, scanner.Err()
+}
+
+// formContentType returns the Content-Type of part: its ;type= or, like
+// curl, the type derived from the file name, defaulting to
+// application/octet-stream for uploaded files only.
+func (p formPart) formContentType() string {
+	if p.contentType != "" {
+		return p.contentType
+	}
+	if p.hasFilename {
+		if contentType, ok := formContentTypes[strings.ToLower(filepath.Ext(p.filename))]; ok {
+			return contentType
+		}
+	}
+	if p.upload && p.path != "-" {
+		return "application/octet-stream"
+	}
+	return ""
+}
+
+// formEscape escapes a field or file name for Content-Disposition. Like
+// curl, double quotes and line breaks are percent-encoded, or with
+// --form-escape, double quotes and backslashes are backslash-escaped.
+func formEscape(s string, backslash bool) string {
+	if backslash {
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+	}
+	return strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// formBody returns a multipart/form-data body streaming parts, and its
+// boundary. Names are escaped with backslashes when escape is set. The
+// length is known unless a part is read from stdin or quoted-printable
+// encoded.
+func formBody(cmd *cobra.Command, parts []formPart, escape bool) (*bodySource, string, error) {
+	boundary := newFormBoundary()
+
+	type section struct {
+		header  string
+		content *bodySource
+		encoder string
+	}
+	sections := make([]section, 0, len(parts))
+	length := int64(len("--" + boundary + "--\r\n"))
+	replayable := true
+	for _, p := range parts {
+		content := literalBody(p.value)
+		if p.path != "" {
+			var err error
+			if content, err = fileBody(cmd, p.path, false); err != nil {
+				return nil, "", err
+			}
+		}
+
+		var header strings.Builder
+		header.WriteString("--" + boundary + "\r\n")
+		header.WriteString(`Content-Disposition: form-data; name="` + formEscape(p.name, escape) + `"`)
+		if p.hasFilename {
+			header.WriteString(`; filename="` + formEscape(p.filename, escape) + `"`)
+		}
+		header.WriteString("\r\n")
+		if contentType := p.formContentType(); contentType != "" {
+			header.WriteString("Content-Type: " + contentType + "\r\n")
+		}
+		if p.encoder != "" {
+			header.WriteString("Content-Transfer-Encoding: " + p.encoder + "\r\n")
+		}
+		for _, h := range p.headers {
+			header.WriteString(h + "\r\n")
+		}
+		header.WriteString("\r\n")
+
+		sections = append(sections, section{header: header.String(), content: content, encoder: p.encoder})
+		replayable = replayable && content.replayable
+
+		contentLength := content.length
+		switch {
+		case contentLength < 0 || p.encoder == "quoted-printable":
+			contentLength = -1
+		case p.encoder == "base64":
+			contentLength = base64Length(contentLength)
+		}
+		if length >= 0 && contentLength >= 0 {
+			length += int64(header.Len()) + contentLength + 2
+		} else {
+			length = -1
+		}
+	}
+
+	write := func(w io.Writer) error {
+		for _, s := range sections {
+			if _, err := io.WriteString(w, s.header); err != nil {
+				return err
+			}
+			if err := writeFormContent(w, s.content, s.encoder); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, "\r\n"); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "--"+boundary+"--\r\n")
+		return err
+	}
+
+	return &bodySource{
+		open: func() (io.ReadCloser, error) {
+			return &lazyReadCloser{start: func() io.ReadCloser {
+				pr, pw := io.Pipe()
+				go func() { pw.CloseWithError(write(pw)) }()
+				return pr
+			}}, nil
+		},
+		length:     length,
+		replayable: replayable,
+	}, boundary, nil
+}
+
+func writeFormContent(w io.Writer, content *bodySource, encoder string) error {
+	r, err := content.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	switch encoder {
+	case "base64":
+		enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: w, width: 76})
+		if _, err := io.Copy(enc, r); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "quoted-printable":
+		enc := quotedprintable.NewWriter(w)
+		if _, err := io.Copy(enc, r); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// base64Length returns the length of n bytes encoded in base64 with a CRLF
+// every 76 characters.
+func base64Length(n int64) int64 {
+	encoded := 4 * ((n + 2) / 3)
+	if encoded == 0 {
+		return 0
+	}
+	return encoded + 2*((encoded-1)/76)
+}
+
+// lineWrapper breaks what is written to w into lines of width characters,
+// separated by CRLF.
+type lineWrapper struct {
+	w      io.Writer
+	width  int
+	column int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if l.column == l.width {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.column = 0
+		}
+		chunk := p[:min(len(p), l.width-l.column)]
+		n, err := l.w.Write(chunk)
+		written += n
+		l.column += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// lazyReadCloser starts reading its source on the first Read, so that a
+// request that is never sent does not leave a writer running.
+type lazyReadCloser struct {
+	start func() io.ReadCloser
+	r     io.ReadCloser
+}
+
+func (l *lazyReadCloser) Read(p []byte) (int, error) {
+	if l.r == nil {
+		l.r = l.start()
+	}
+	return l.r.Read(p)
+}
+
+func (l *lazyReadCloser) Close() error {
+	if l.r == nil {
+		return nil
+	}
+	return l.r.Close()
+}
+
+// newFormBoundary returns a boundary in curl's format.
+func newFormBoundary() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return strings.Repeat("-", 24) + hex.EncodeToString(b)
+}
@@ -0,0 +1,252 @@
+package cobracurl
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormField(t *testing.T) {
+	dir := t.TempDir()
+	headersPath := filepath.Join(dir, "headers")
+	require.NoError(t, os.WriteFile(headersPath, []byte("X-A: 1\n# comment\n\nX-B: 2\n"), 0o600))
+
+	tests := []struct {
+		spec     string
+		expected formPart
+	}{
+		{spec: "name=value", expected: formPart{name: "name", value: "value"}},
+		{spec: "name=", expected: formPart{name: "name"}},
+		{spec: "name=a;b", expected: formPart{name: "name", value: "a"}},
+		{spec: `name="a;b";type=text/x-a`, expected: formPart{name: "name", value: "a;b", contentType: "text/x-a"}},
+		{spec: `name="a\"b"`, expected: formPart{name: "name", value: `a"b`}},
+		{spec: "name=v;type=text/plain; charset=utf-8", expected: formPart{name: "name", value: "v", contentType: "text/plain; charset=utf-8"}},
+		{spec: "name=v;unknown=x;type=a/b", expected: formPart{name: "name", value: "v", contentType: "a/b"}},
+		{spec: "name=v;flag;type=a/b", expected: formPart{name: "name", value: "v", contentType: "a/b"}},
+		{spec: "file=@dir/report.pdf", expected: formPart{name: "file", path: "dir/report.pdf", upload: true, filename: "report.pdf", hasFilename: true}},
+		{spec: `file=@"a;b.txt";filename=c.txt;type=text/x-c`, expected: formPart{name: "file", path: "a;b.txt", upload: true, filename: "c.txt", hasFilename: true, contentType: "text/x-c"}},
+		{spec: "text=<notes.txt", expected: formPart{name: "text", path: "notes.txt"}},
+		{spec: "v=1;headers=X-A: 1;headers=@" + headersPath, expected: formPart{name: "v", value: "1", headers: []string{"X-A: 1", "X-A: 1", "X-B: 2"}}},
+		{spec: "v=1;encoder=base64", expected: formPart{name: "v", value: "1", encoder: "base64"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			part, err := parseFormField(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, part)
+		})
+	}
+
+	for _, spec := range []string{"novalue", "=value", "file=@", "v=1;encoder=rot13"} {
+		_, err := parseFormField(spec)
+		assert.ErrorIs(t, err, ErrInvalidFormField, spec)
+	}
+}
+
+func TestBuildRequestForm(t *testing.T) {
+	dir := t.TempDir()
+	uploadPath := filepath.Join(dir, "artifact.bin")
+	upload := strings.Repeat("\x00\x01artifact", 50_000)
+	require.NoError(t, os.WriteFile(uploadPath, []byte(upload), 0o600))
+	notesPath := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(notesPath, []byte("some notes\n"), 0o600))
+
+	type receivedPart struct {
+		name, filename, contentType, encoding, custom, content string
+	}
+	received := make(chan []receivedPart, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Positive(t, r.ContentLength)
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		assert.Equal(t, "multipart/form-data", mediaType)
+
+		var parts []receivedPart
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			p, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err) {
+				break
+			}
+			content, _ := io.ReadAll(p)
+			parts = append(parts, receivedPart{
+				name:        p.FormName(),
+				filename:    p.FileName(),
+				contentType: p.Header.Get("Content-Type"),
+				encoding:    p.Header.Get("Content-Transfer-Encoding"),
+				custom:      p.Header.Get("X-Custom"),
+				content:     string(content),
+			})
+		}
+		received <- parts
+	}))
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", srv.URL, "")
+	RegisterFormFlag(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{
+		"-F", "z=last?;headers=X-Custom: yes",
+		"-F", "artifact=@" + uploadPath,
+		"-F", "notes=<" + notesPath,
+		"-F", "a=abc;encoder=base64",
+		"-F", "renamed=@" + notesPath + ";filename=readme.html",
+	}))
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, req.Method)
+	require.NotNil(t, req.GetBody)
+
+	for range 2 {
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, []receivedPart{
+			{name: "z", custom: "yes", content: "last?"},
+			{name: "artifact", filename: "artifact.bin", contentType: "application/octet-stream", content: upload},
+			{name: "notes", content: "some notes\n"},
+			{name: "a", encoding: "base64", content: base64.StdEncoding.EncodeToString([]byte("abc"))},
+			{name: "renamed", filename: "readme.html", contentType: "text/html", content: "some notes\n"},
+		}, <-received)
+
+		req.Body, err = req.GetBody()
+		require.NoError(t, err)
+	}
+}
+
+func TestBuildRequestFormLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", 200)), 0o600))
+
+	for _, spec := range []string{"f=@" + path, "f=<" + path + ";encoder=base64", "f=;encoder=base64", `na"me=v`} {
+		t.Run(spec, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", "http://example.com", "")
+			cmd.Flags().StringArray("form", []string{spec, "g=1"}, "")
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(body)), req.ContentLength)
+		})
+	}
+}
+
+func TestBuildRequestFormBase64LineLength(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().StringArray("form", []string{"f=" + strings.Repeat("y", 100) + ";encoder=base64"}, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("y", 100)))
+	assert.Contains(t, string(body), "\r\n\r\n"+encoded[:76]+"\r\n"+encoded[76:]+"\r\n--")
+}
+
+func TestBuildRequestFormStdin(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.SetIn(strings.NewReader("from stdin"))
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().StringArray("form", []string{"f=@-"}, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), req.ContentLength)
+	assert.Nil(t, req.GetBody)
+
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "Content-Disposition: form-data; name=\"f\"; filename=\"-\"\r\n\r\nfrom stdin\r\n")
+}
+
+func TestBuildRequestFormMissingFile(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().StringArray("form", []string{"f=@" + filepath.Join(t.TempDir(), "missing")}, "")
+
+	_, err := BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBuildRequestFormString(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `q"x\y.txt`)
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+	tests := []struct {
+		name                string
+		escape              bool
+		expectedDisposition string
+	}{
+		{
+			name:                "percent-encoded names",
+			expectedDisposition: `form-data; name="n%22a\me"; filename="q%22x\y.txt"`,
+		},
+		{
+			name:                "backslash-escaped names",
+			escape:              true,
+			expectedDisposition: `form-data; name="n\"a\\me"; filename="q\"x\\y.txt"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", "http://example.com", "")
+			cmd.Flags().Bool("form-escape", tt.escape, "")
+			RegisterFormFlag(cmd.Flags())
+			RegisterFormStringFlag(cmd.Flags())
+			require.NoError(t, cmd.Flags().Parse([]string{
+				"--form-string", "s=@literal;type=x",
+				"-F", `n"a\me=@` + path,
+				"--form-string", "t=<also literal",
+			}))
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, http.MethodPost, req.Method)
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+
+			_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			require.NoError(t, err)
+			delimiter := "--" + params["boundary"]
+			assert.Equal(t, delimiter+"\r\n"+
+				"Content-Disposition: form-data; name=\"s\"\r\n\r\n@literal;type=x\r\n"+
+				delimiter+"\r\n"+
+				"Content-Disposition: "+tt.expectedDisposition+"\r\nContent-Type: text/plain\r\n\r\ndata\r\n"+
+				delimiter+"\r\n"+
+				"Content-Disposition: form-data; name=\"t\"\r\n\r\n<also literal\r\n"+
+				delimiter+"--\r\n", string(body))
+		})
+	}
+}
+
+func TestBuildRequestFormStringInvalid(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().StringArray("form-string", []string{"novalue"}, "")
+
+	_, err := BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, ErrInvalidFormField)
+}
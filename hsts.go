@@ -0,0 +1,249 @@
+package cobracurl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const hstsTimeFormat = "20060102 15:04:05"
+
+// HSTSEntry is a host that announced Strict-Transport-Security, as stored
+// in curl's HSTS file. A zero Expires means the entry never expires.
+type HSTSEntry struct {
+	Host              string
+	IncludeSubDomains bool
+	Expires           time.Time
+}
+
+func (e HSTSEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// HSTSCache holds the hosts known to require HTTPS and persists them in
+// curl's HSTS file format.
+type HSTSCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]HSTSEntry
+}
+
+// LoadHSTSCache reads the HSTS cache file at path. A missing file yields an
+// empty cache that is created on the first Save.
+func LoadHSTSCache(path string) (*HSTSCache, error) {
+	c := &HSTSCache{path: path, entries: map[string]HSTSEntry{}}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading hsts cache: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry, err := parseHSTSLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("parsing hsts cache %s: %w", path, err)
+		}
+		c.entries[entry.Host] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading hsts cache: %w", err)
+	}
+
+	return c, nil
+}
+
+// parseHSTSLine parses a line such as `.example.com "20260101 10:00:00"` or
+// `example.com unlimited`. A leading dot marks includeSubDomains.
+func parseHSTSLine(line string) (HSTSEntry, error) {
+	host, expiry, ok := strings.Cut(line, " ")
+	if !ok {
+		return HSTSEntry{}, fmt.Errorf("invalid line %q", line)
+	}
+
+	entry := HSTSEntry{Host: strings.ToLower(strings.TrimPrefix(host, "."))}
+	entry.IncludeSubDomains = strings.HasPrefix(host, ".")
+
+	expiry = strings.TrimSpace(expiry)
+	if expiry != "unlimited" {
+		expires, err := time.Parse(hstsTimeFormat, strings.Trim(expiry, `"`))
+		if err != nil {
+			return HSTSEntry{}, fmt.Errorf("invalid date in %q: %w", line, err)
+		}
+		entry.Expires = expires
+	}
+
+	return entry, nil
+}
+
+// Save writes the unexpired entries to the cache file.
+func (c *HSTSCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.path == "" {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("# Your HSTS cache. https://curl.se/docs/hsts.html\n")
+	b.WriteString("# This file was generated by cobracurl! Edit at your own risk.\n")
+	now := time.Now()
+	for _, e := range c.entries {
+		if e.expired(now) {
+			continue
+		}
+		host := e.Host
+		if e.IncludeSubDomains {
+			host = "." + host
+		}
+		expiry := "unlimited"
+		if !e.Expires.IsZero() {
+			expiry = `"` + e.Expires.UTC().Format(hstsTimeFormat) + `"`
+		}
+		fmt.Fprintf(&b, "%s %s\n", host, expiry)
+	}
+
+	if err := os.WriteFile(c.path, []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("writing hsts cache: %w", err)
+	}
+	return nil
+}
+
+// Match reports whether requests to host must use HTTPS, either because host
+// itself is known or because a parent domain announced includeSubDomains.
+func (c *HSTSCache) Match(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	name := host
+	for {
+		if e, ok := c.entries[name]; ok && !e.expired(now) && (name == host || e.IncludeSubDomains) {
+			return true
+		}
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			return false
+		}
+		name = parent
+	}
+}
+
+// Update applies a Strict-Transport-Security header received from host over
+// HTTPS. max-age=0 removes the host. Headers for IP addresses are ignored.
+func (c *HSTSCache) Update(host, header string) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || net.ParseIP(host) != nil {
+		return
+	}
+
+	maxAge, includeSubDomains, ok := parseSTSHeader(header)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if maxAge <= 0 {
+		delete(c.entries, host)
+		return
+	}
+	c.entries[host] = HSTSEntry{
+		Host:              host,
+		IncludeSubDomains: includeSubDomains,
+		Expires:           time.Now().Add(maxAge),
+	}
+}
+
+// parseSTSHeader parses a Strict-Transport-Security header value
+// (RFC 6797). It reports false when max-age is missing or invalid.
+func parseSTSHeader(header string) (maxAge time.Duration, includeSubDomains, ok bool) {
+	for _, directive := range strings.Split(header, ";") {
+		name, val, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(val), `"`), 10, 64)
+			if err != nil || seconds < 0 {
+				return 0, false, false
+			}
+			maxAge, ok = time.Duration(seconds)*time.Second, true
+		case "includesubdomains":
+			includeSubDomains = true
+		}
+	}
+	return maxAge, includeSubDomains, ok
+}
+
+// Upgrade returns u switched to https when its host is known, with port 80
+// changed to 443. Other URLs are returned unchanged.
+func (c *HSTSCache) Upgrade(u *url.URL) *url.URL {
+	if u.Scheme != "http" || !c.Match(u.Hostname()) {
+		return u
+	}
+	upgraded := *u
+	upgraded.Scheme = "https"
+	if u.Port() == "80" {
+		upgraded.Host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	return &upgraded
+}
+
+// hstsTransport upgrades http:// requests to known HSTS hosts to https://
+// and records Strict-Transport-Security headers of HTTPS responses.
+type hstsTransport struct {
+	cache *HSTSCache
+	next  http.RoundTripper
+	// saveError reports the errors saving the cache.
+	saveError func(error)
+}
+
+func (t *hstsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if upgraded := t.cache.Upgrade(req.URL); upgraded != req.URL {
+		originalHost := req.URL.Host
+		req = req.Clone(req.Context())
+		req.URL = upgraded
+		if req.Host == originalHost {
+			req.Host = upgraded.Host
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if header := resp.Header.Get("Strict-Transport-Security"); header != "" && req.URL.Scheme == "https" {
+		t.cache.Update(req.URL.Hostname(), header)
+		if err := t.cache.Save(); err != nil && t.saveError != nil {
+			t.saveError(err)
+		}
+	}
+	return resp, nil
+}
+
+func (t *hstsTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
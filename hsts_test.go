@@ -0,0 +1,173 @@
+package cobracurl
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSTSHeader(t *testing.T) {
+	maxAge, includeSubDomains, ok := parseSTSHeader(`max-age="31536000"; includeSubDomains; preload`)
+	assert.True(t, ok)
+	assert.True(t, includeSubDomains)
+	assert.Equal(t, 31536000*time.Second, maxAge)
+
+	_, _, ok = parseSTSHeader("includeSubDomains")
+	assert.False(t, ok)
+	_, _, ok = parseSTSHeader("max-age=abc")
+	assert.False(t, ok)
+}
+
+func TestHSTSCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hsts.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n.example.com unlimited\nexpired.org \"20000101 00:00:00\"\n"), 0o600))
+
+	cache, err := LoadHSTSCache(path)
+	require.NoError(t, err)
+
+	assert.True(t, cache.Match("example.com"))
+	assert.True(t, cache.Match("www.EXAMPLE.com."))
+	assert.False(t, cache.Match("expired.org"))
+	assert.False(t, cache.Match("example.org"))
+
+	cache.Update("secure.net", "max-age=3600")
+	cache.Update("127.0.0.1", "max-age=3600")
+	cache.Update("example.com", "max-age=0")
+	assert.True(t, cache.Match("secure.net"))
+	assert.False(t, cache.Match("sub.secure.net"))
+	assert.False(t, cache.Match("127.0.0.1"))
+	assert.False(t, cache.Match("example.com"))
+	require.NoError(t, cache.Save())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[2], `secure.net "`), lines[2])
+
+	reloaded, err := LoadHSTSCache(path)
+	require.NoError(t, err)
+	assert.True(t, reloaded.Match("secure.net"))
+
+	_, err = LoadHSTSCache(writeTempFile(t, []byte("invalid\n")))
+	require.Error(t, err)
+}
+
+func TestBuildRequestHSTS(t *testing.T) {
+	hstsFile := writeTempFile(t, []byte("example.com unlimited\n"))
+
+	tests := []struct {
+		name        string
+		url         string
+		expectedURL string
+	}{
+		{name: "known host is upgraded", url: "http://example.com/path?q=1", expectedURL: "https://example.com/path?q=1"},
+		{name: "port 80 becomes 443", url: "http://example.com:80/", expectedURL: "https://example.com:443/"},
+		{name: "other ports are kept", url: "http://example.com:8080/", expectedURL: "https://example.com:8080/"},
+		{name: "unknown host is unchanged", url: "http://example.org/", expectedURL: "http://example.org/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", tt.url, "")
+			cmd.Flags().String("hsts", hstsFile, "")
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, req.URL.String())
+		})
+	}
+}
+
+func TestBuildClientHSTS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=60")
+		_, _ = w.Write([]byte("secure"))
+	}))
+	defer srv.Close()
+
+	caFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	hstsFile := filepath.Join(t.TempDir(), "hsts.txt")
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+
+	newClient := func() *http.Client {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("cacert", caFile, "")
+		cmd.Flags().String("hsts", hstsFile, "")
+
+		client, err := BuildClient(cmd)
+		require.NoError(t, err)
+		// The test certificate is issued for example.com; send it to srv.
+		transport := client.Transport.(*hstsTransport).next.(*http.Transport)
+		transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+		}
+		return client
+	}
+
+	get := func(client *http.Client, rawURL string) (string, error) {
+		resp, err := client.Get(rawURL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	httpURL := (&url.URL{Scheme: "http", Host: net.JoinHostPort("example.com", port), Path: "/"}).String()
+
+	body, err := get(newClient(), httpURL)
+	require.NoError(t, err)
+	assert.NotEqual(t, "secure", body, "plain HTTP must reach the TLS server unchanged before HSTS is known")
+
+	body, err = get(newClient(), "https://"+net.JoinHostPort("example.com", port)+"/")
+	require.NoError(t, err)
+	assert.Equal(t, "secure", body)
+
+	body, err = get(newClient(), httpURL)
+	require.NoError(t, err)
+	assert.Equal(t, "secure", body)
+}
+
+func TestBuildClientHSTSSaveError(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=60")
+	}))
+	defer srv.Close()
+
+	var stderr strings.Builder
+	cmd := &cobra.Command{}
+	cmd.SetErr(&stderr)
+	cmd.Flags().Bool("insecure", true, "")
+	cmd.Flags().String("hsts", filepath.Join(t.TempDir(), "missing", "hsts.txt"), "")
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+	// HSTS ignores IP addresses; send example.com to srv.
+	transport := client.Transport.(*hstsTransport).next.(*http.Transport)
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+
+	for range 2 {
+		resp, err := client.Get("https://example.com/")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, 1, strings.Count(stderr.String(), "Warning: writing hsts cache:"), stderr.String())
+}
@@ -0,0 +1,226 @@
+package cobracurl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// DefaultHappyEyeballsTimeout is how long an HTTP/3 attempt gets a head start
+// over TCP when --http3 races both.
+const DefaultHappyEyeballsTimeout = 200 * time.Millisecond
+
+// newHTTP3Transport returns an HTTP/3 transport sharing the TLS settings of t.
+func newHTTP3Transport(t *http.Transport, handshakeTimeout time.Duration) *http3.Transport {
+	h3 := &http3.Transport{TLSClientConfig: t.TLSClientConfig, DisableCompression: t.DisableCompression}
+	if handshakeTimeout > 0 {
+		h3.QUICConfig = &quic.Config{HandshakeIdleTimeout: handshakeTimeout}
+	}
+	return h3
+}
+
+// http3RaceTransport sends HTTPS requests over HTTP/3 or TCP, whichever
+// connects first, the way curl does with --http3. The QUIC attempt starts
+// right away and TCP follows after delay, or as soon as QUIC fails. Hosts
+// where TCP won keep using TCP.
+type http3RaceTransport struct {
+	h3    *http3.Transport
+	tcp   *http.Transport
+	delay time.Duration
+
+	mu       sync.Mutex
+	tcpHosts map[string]bool
+	quicConn map[string]*quic.Conn
+	tcpConn  map[string]net.Conn
+}
+
+func newHTTP3RaceTransport(tcp *http.Transport, h3 *http3.Transport, delay time.Duration) *http3RaceTransport {
+	t := &http3RaceTransport{
+		h3:       h3,
+		tcp:      tcp,
+		delay:    delay,
+		tcpHosts: map[string]bool{},
+		quicConn: map[string]*quic.Conn{},
+		tcpConn:  map[string]net.Conn{},
+	}
+
+	dialTCP := tcp.DialContext
+	if dialTCP == nil {
+		dialTCP = (&net.Dialer{}).DialContext
+	}
+	tcp.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if conn := t.takeTCPConn(addr); conn != nil {
+			return conn, nil
+		}
+		return dialTCP(ctx, network, addr)
+	}
+	h3.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		if conn := t.takeQUICConn(addr); conn != nil {
+			return conn, nil
+		}
+		return quic.DialAddrEarly(ctx, addr, tlsCfg, cfg)
+	}
+	return t
+}
+
+func (t *http3RaceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || t.usesProxy(req) {
+		return t.tcp.RoundTrip(req)
+	}
+
+	addr := canonicalAddr(req.URL)
+	t.mu.Lock()
+	preferTCP := t.tcpHosts[addr]
+	t.mu.Unlock()
+	if preferTCP {
+		return t.tcp.RoundTrip(req)
+	}
+
+	resp, err := t.h3.RoundTripOpt(req, http3.RoundTripOpt{OnlyCachedConn: true})
+	if !errors.Is(err, http3.ErrNoCachedConn) {
+		return resp, err
+	}
+
+	useQUIC, err := t.race(req.Context(), addr, req.URL.Hostname())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	if useQUIC {
+		return t.h3.RoundTrip(req)
+	}
+	return t.tcp.RoundTrip(req)
+}
+
+// race connects to addr over QUIC and TCP and stores the winning connection
+// for the matching transport to pick up. It reports whether QUIC won.
+func (t *http3RaceTransport) race(ctx context.Context, addr, serverName string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	quicDone := make(chan dialResult, 1)
+	tcpDone := make(chan dialResult, 1)
+
+	go func() {
+		conn, err := quic.DialAddr(ctx, addr, t.quicTLSConfig(serverName), t.h3.QUICConfig)
+		quicDone <- dialResult{quic: conn, err: err}
+	}()
+
+	startTCP := func() {
+		go func() {
+			conn, err := t.tcp.DialContext(ctx, "tcp", addr)
+			tcpDone <- dialResult{tcp: conn, err: err}
+		}()
+	}
+	timer := time.NewTimer(t.delay)
+	defer timer.Stop()
+
+	var errs []error
+	tcpStarted, pending := false, 2
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if !tcpStarted {
+				tcpStarted = true
+				startTCP()
+			}
+		case r := <-quicDone:
+			pending--
+			if r.err != nil {
+				errs = append(errs, r.err)
+				if !tcpStarted {
+					tcpStarted = true
+					startTCP()
+				}
+				continue
+			}
+			t.mu.Lock()
+			t.quicConn[addr] = r.quic
+			t.mu.Unlock()
+			if tcpStarted {
+				go closeLoser(tcpDone)
+			}
+			return true, nil
+		case r := <-tcpDone:
+			pending--
+			if r.err != nil {
+				errs = append(errs, r.err)
+				continue
+			}
+			t.mu.Lock()
+			t.tcpConn[addr] = r.tcp
+			t.tcpHosts[addr] = true
+			t.mu.Unlock()
+			if pending > 0 {
+				go closeLoser(quicDone)
+			}
+			return false, nil
+		}
+	}
+	return false, errors.Join(errs...)
+}
+
+type dialResult struct {
+	quic *quic.Conn
+	tcp  net.Conn
+	err  error
+}
+
+// closeLoser closes the connection of the attempt that lost the race.
+func closeLoser(ch <-chan dialResult) {
+	r := <-ch
+	if r.quic != nil {
+		_ = r.quic.CloseWithError(0, "")
+	}
+	if r.tcp != nil {
+		r.tcp.Close()
+	}
+}
+
+func (t *http3RaceTransport) quicTLSConfig(serverName string) *tls.Config {
+	cfg := &tls.Config{} //nolint:gosec
+	if t.h3.TLSClientConfig != nil {
+		cfg = t.h3.TLSClientConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = serverName
+	}
+	cfg.NextProtos = []string{http3.NextProtoH3}
+	return cfg
+}
+
+func (t *http3RaceTransport) usesProxy(req *http.Request) bool {
+	if t.tcp.Proxy == nil {
+		return false
+	}
+	proxyURL, err := t.tcp.Proxy(req)
+	return err != nil || proxyURL != nil
+}
+
+func (t *http3RaceTransport) takeTCPConn(addr string) net.Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn := t.tcpConn[addr]
+	delete(t.tcpConn, addr)
+	return conn
+}
+
+func (t *http3RaceTransport) takeQUICConn(addr string) *quic.Conn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn := t.quicConn[addr]
+	delete(t.quicConn, addr)
+	return conn
+}
+
+func (t *http3RaceTransport) CloseIdleConnections() {
+	t.tcp.CloseIdleConnections()
+	t.h3.CloseIdleConnections()
+}
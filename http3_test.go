@@ -0,0 +1,100 @@
+package cobracurl
+
+import (
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHTTP3TestServer starts a TCP TLS server and, when withQUIC is set, an
+// HTTP/3 server on the same UDP port. Both reply with the request protocol.
+// It returns the server URL and a CA file trusting its certificate.
+func newHTTP3TestServer(t *testing.T, withQUIC bool) (string, string) {
+	t.Helper()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	if withQUIC {
+		udpAddr, err := net.ResolveUDPAddr("udp", srv.Listener.Addr().String())
+		require.NoError(t, err)
+		udpConn, err := net.ListenUDP("udp", udpAddr)
+		require.NoError(t, err)
+
+		h3 := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(srv.TLS.Clone())}
+		go func() { _ = h3.Serve(udpConn) }()
+		t.Cleanup(func() {
+			h3.Close()
+			udpConn.Close()
+		})
+	}
+
+	caFile := writeTempFile(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	return srv.URL, caFile
+}
+
+func TestBuildClientHTTP3(t *testing.T) {
+	tests := []struct {
+		name          string
+		flag          string
+		withQUIC      bool
+		expectedProto string
+		expectedError bool
+	}{
+		{name: "http3-only uses HTTP/3", flag: "http3-only", withQUIC: true, expectedProto: "HTTP/3.0"},
+		{name: "http3-only fails without HTTP/3 server", flag: "http3-only", expectedError: true},
+		{name: "http3 prefers HTTP/3", flag: "http3", withQUIC: true, expectedProto: "HTTP/3.0"},
+		{name: "http3 falls back to TCP", flag: "http3", expectedProto: "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srvURL, caFile := newHTTP3TestServer(t, tt.withQUIC)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("cacert", caFile, "")
+			cmd.Flags().Float64("connect-timeout", 1, "")
+			cmd.Flags().Bool(tt.flag, true, "")
+
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+			defer client.CloseIdleConnections()
+
+			for range 2 {
+				resp, err := client.Get(srvURL)
+				if tt.expectedError {
+					require.Error(t, err)
+					return
+				}
+				require.NoError(t, err)
+
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedProto, string(body))
+			}
+		})
+	}
+}
+
+func TestBuildClientHTTP3OnlyWithProxy(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("http3-only", true, "")
+	cmd.Flags().String("proxy", "http://proxy.example.com:8080", "")
+
+	_, err := BuildClient(cmd)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http3-only")
+}
@@ -0,0 +1,90 @@
+package cobracurl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// JSONSyntaxError is returned by BuildRequest when JSON validation is
+// enabled and the --json payload is not valid JSON. Line and Column are
+// 1-based and point at the offending byte.
+type JSONSyntaxError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *JSONSyntaxError) Error() string {
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *JSONSyntaxError) Unwrap() error {
+	return e.Err
+}
+
+type jsonValidationKey struct{}
+
+// WithJSONValidation returns a copy of ctx that makes BuildRequest check
+// that the --json payload is valid JSON before the request is sent. The
+// payload is then read in full, including files and stdin. Set it on the
+// command with cmd.SetContext.
+func WithJSONValidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jsonValidationKey{}, true)
+}
+
+func jsonValidationFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(jsonValidationKey{}).(bool)
+	return enabled
+}
+
+// jsonArgsBody returns the body of the --json values in args. Like curl,
+// values are concatenated without separator, and @file and @- send the
+// content of a file or of stdin untouched.
+func jsonArgsBody(cmd *cobra.Command, args []flagArg) (*bodySource, error) {
+	parts := make([]*bodySource, 0, len(args))
+	for _, arg := range args {
+		part, err := dataBody(cmd, arg.value, false)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	body := concatBodies(parts)
+	if !jsonValidationFromContext(cmd.Context()) {
+		return body, nil
+	}
+
+	payload, err := body.String()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateJSON([]byte(payload)); err != nil {
+		return nil, err
+	}
+	return literalBody(payload), nil
+}
+
+// validateJSON returns a *JSONSyntaxError locating the first syntax error
+// of data, if any.
+func validateJSON(data []byte) error {
+	var v any
+	err := json.Unmarshal(data, &v)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+
+	// Offset counts the bytes read, up to and including the offending one.
+	pos := min(max(int(syntaxErr.Offset)-1, 0), len(data))
+	line := 1 + bytes.Count(data[:pos], []byte("\n"))
+	column := pos - bytes.LastIndexByte(data[:pos], '\n')
+	return &JSONSyntaxError{Line: line, Column: column, Err: err}
+}
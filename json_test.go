@@ -0,0 +1,136 @@
+package cobracurl
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildRequestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	require.NoError(t, os.WriteFile(path, []byte("{\"a\":\n1}\n"), 0o600))
+
+	tests := []struct {
+		name           string
+		args           []string
+		stdin          string
+		expectedBody   string
+		expectedLength int64
+	}{
+		{
+			name:           "literal",
+			args:           []string{"--json", `{"a":1}`},
+			expectedBody:   `{"a":1}`,
+			expectedLength: 7,
+		},
+		{
+			name:           "file kept untouched",
+			args:           []string{"--json", "@" + path},
+			expectedBody:   "{\"a\":\n1}\n",
+			expectedLength: 9,
+		},
+		{
+			name:           "stdin",
+			args:           []string{"--json", "@-"},
+			stdin:          `{"b":2}`,
+			expectedBody:   `{"b":2}`,
+			expectedLength: -1,
+		},
+		{
+			name:           "repeated values are concatenated",
+			args:           []string{"--json", `{"a":`, "--json", "@" + path, "--json", "}"},
+			expectedBody:   "{\"a\":{\"a\":\n1}\n}",
+			expectedLength: 15,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetIn(strings.NewReader(tt.stdin))
+			cmd.Flags().String("url", "http://example.com", "")
+			RegisterJsonFlag(cmd.Flags())
+			require.NoError(t, cmd.Flags().Parse(tt.args))
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "POST", req.Method)
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+			assert.Equal(t, "application/json", req.Header.Get("Accept"))
+			assert.Equal(t, tt.expectedLength, req.ContentLength)
+
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestBuildRequestJSONValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	require.NoError(t, os.WriteFile(path, []byte("{\n  \"a\": 1,\n  \"b\": tru\n}\n"), 0o600))
+
+	tests := []struct {
+		name           string
+		json           []string
+		stdin          string
+		expectedBody   string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{name: "valid", json: []string{`{"a":`, `[1, 2]}`}, expectedBody: `{"a":[1, 2]}`},
+		{name: "valid from stdin", json: []string{"@-"}, stdin: `{"ok":true}`, expectedBody: `{"ok":true}`},
+		{name: "invalid file", json: []string{"@" + path}, expectedLine: 3, expectedColumn: 11},
+		{name: "trailing comma", json: []string{`{"a":1,}`}, expectedLine: 1, expectedColumn: 8},
+		{name: "concatenated values", json: []string{`{"a":1}`, `{"b":2}`}, expectedLine: 1, expectedColumn: 8},
+		{name: "truncated", json: []string{"{\"a\":\n"}, expectedLine: 1, expectedColumn: 6},
+		{name: "empty stdin", json: []string{"@-"}, expectedLine: 1, expectedColumn: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetContext(WithJSONValidation(context.Background()))
+			cmd.SetIn(strings.NewReader(tt.stdin))
+			cmd.Flags().String("url", "http://example.com", "")
+			cmd.Flags().StringArray("json", tt.json, "")
+
+			req, err := BuildRequest(cmd, nil)
+			if tt.expectedLine == 0 {
+				require.NoError(t, err)
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBody, string(body))
+				assert.Equal(t, int64(len(body)), req.ContentLength)
+				return
+			}
+
+			var syntaxErr *JSONSyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.expectedLine, syntaxErr.Line)
+			assert.Equal(t, tt.expectedColumn, syntaxErr.Column)
+			var jsonErr *json.SyntaxError
+			assert.ErrorAs(t, err, &jsonErr)
+		})
+	}
+}
+
+func TestBuildRequestJSONNotValidatedByDefault(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().String("json", "{not json", "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "{not json", string(body))
+}
@@ -0,0 +1,196 @@
+package cobracurl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ErrNetrcNoCredentials is returned with --netrc when the netrc file has no
+// credentials for the request host.
+var ErrNetrcNoCredentials = errors.New("no credentials found in netrc")
+
+// NetrcMachine is a machine or default entry of a netrc file.
+type NetrcMachine struct {
+	Name     string
+	Default  bool
+	Login    string
+	Password string
+	Account  string
+}
+
+// ParseNetrc parses a netrc file. Tokens are separated by white space and
+// may be double-quoted; # starts a comment and macdef bodies are skipped.
+func ParseNetrc(r io.Reader) ([]NetrcMachine, error) {
+	var machines []NetrcMachine
+	var current *NetrcMachine
+
+	scanner := bufio.NewScanner(r)
+	inMacdef := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacdef {
+			inMacdef = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		tokens, err := netrcTokens(line)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(tokens); i++ {
+			keyword := tokens[i]
+			switch keyword {
+			case "default":
+				machines = append(machines, NetrcMachine{Default: true})
+				current = &machines[len(machines)-1]
+				continue
+			case "macdef":
+				// The macro body runs until the next empty line.
+				inMacdef = true
+				i = len(tokens)
+				continue
+			}
+
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("netrc: missing value for %q", keyword)
+			}
+			i++
+			value := tokens[i]
+			if keyword == "machine" {
+				machines = append(machines, NetrcMachine{Name: value})
+				current = &machines[len(machines)-1]
+				continue
+			}
+			if current == nil {
+				return nil, fmt.Errorf("netrc: %q before machine or default", keyword)
+			}
+			switch keyword {
+			case "login":
+				current.Login = value
+			case "password":
+				current.Password = value
+			case "account":
+				current.Account = value
+			default:
+				return nil, fmt.Errorf("netrc: unknown token %q", keyword)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return machines, nil
+}
+
+// netrcTokens splits a netrc line into tokens, dropping comments.
+func netrcTokens(line string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			return tokens, nil
+		case c == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 'r':
+						b.WriteByte('\r')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(line[i])
+					}
+					continue
+				}
+				b.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, errors.New("netrc: unterminated quoted string")
+			}
+			i++
+			tokens = append(tokens, b.String())
+		default:
+			end := strings.IndexAny(line[i:], " \t\r")
+			if end < 0 {
+				end = len(line) - i
+			}
+			tokens = append(tokens, line[i:i+end])
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// LookupNetrc returns the first entry for host, restricted to login when it
+// is not empty, falling back to the default entry.
+func LookupNetrc(machines []NetrcMachine, host, login string) (NetrcMachine, bool) {
+	for _, m := range machines {
+		if m.Default || !strings.EqualFold(m.Name, host) {
+			continue
+		}
+		if login == "" || m.Login == login {
+			return m, true
+		}
+	}
+	for _, m := range machines {
+		if m.Default && (login == "" || m.Login == login) {
+			return m, true
+		}
+	}
+	return NetrcMachine{}, false
+}
+
+// netrcCredentials looks up host in the netrc file selected by --netrc,
+// --netrc-file or --netrc-optional. ok is false when netrc is not enabled
+// or, with --netrc-optional, has no entry for host.
+func netrcCredentials(cmd *cobra.Command, host, login string) (string, string, bool, error) {
+	useNetrc, _ := cmd.Flags().GetBool("netrc")
+	optional, _ := cmd.Flags().GetBool("netrc-optional")
+	path, _ := cmd.Flags().GetString("netrc-file")
+	if !useNetrc && !optional && path == "" {
+		return "", "", false, nil
+	}
+
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false, fmt.Errorf("locating netrc: %w", err)
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if optional && errors.Is(err, os.ErrNotExist) {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("reading netrc: %w", err)
+	}
+	defer f.Close()
+
+	machines, err := ParseNetrc(f)
+	if err != nil {
+		return "", "", false, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if m, ok := LookupNetrc(machines, host, login); ok && m.Login != "" {
+		return m.Login, m.Password, true, nil
+	}
+	if optional {
+		return "", "", false, nil
+	}
+	return "", "", false, fmt.Errorf("%w for %s", ErrNetrcNoCredentials, host)
+}
@@ -0,0 +1,118 @@
+package cobracurl
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNetrc = `# ops credentials
+machine api.example.com login alice password "s3cr\"et"
+machine api.example.com
+  login bob
+  password hunter2
+macdef init
+cd /pub
+machine ignored.example.com login nobody password nothing
+
+machine other.example.com login carol password pw account acct
+default login anonymous password guest@example.com
+`
+
+func TestParseNetrc(t *testing.T) {
+	machines, err := ParseNetrc(strings.NewReader(testNetrc))
+	require.NoError(t, err)
+	require.Len(t, machines, 4)
+
+	assert.Equal(t, NetrcMachine{Name: "api.example.com", Login: "alice", Password: `s3cr"et`}, machines[0])
+	assert.Equal(t, NetrcMachine{Name: "api.example.com", Login: "bob", Password: "hunter2"}, machines[1])
+	assert.Equal(t, NetrcMachine{Name: "other.example.com", Login: "carol", Password: "pw", Account: "acct"}, machines[2])
+	assert.Equal(t, NetrcMachine{Default: true, Login: "anonymous", Password: "guest@example.com"}, machines[3])
+
+	_, err = ParseNetrc(strings.NewReader("login alice"))
+	require.Error(t, err)
+	_, err = ParseNetrc(strings.NewReader(`machine x password "open`))
+	require.Error(t, err)
+}
+
+func TestLookupNetrc(t *testing.T) {
+	machines, err := ParseNetrc(strings.NewReader(testNetrc))
+	require.NoError(t, err)
+
+	m, ok := LookupNetrc(machines, "API.example.com", "")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", m.Login)
+
+	m, ok = LookupNetrc(machines, "api.example.com", "bob")
+	assert.True(t, ok)
+	assert.Equal(t, "hunter2", m.Password)
+
+	m, ok = LookupNetrc(machines, "unknown.example.com", "")
+	assert.True(t, ok)
+	assert.Equal(t, "anonymous", m.Login)
+
+	_, ok = LookupNetrc(machines[:3], "unknown.example.com", "")
+	assert.False(t, ok)
+}
+
+func TestBuildRequestNetrc(t *testing.T) {
+	netrcFile := writeTempFile(t, []byte(testNetrc))
+	noDefault := writeTempFile(t, []byte("machine api.example.com login alice password secret\n"))
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name           string
+		url            string
+		user           string
+		flags          map[string]string
+		expectedUser   string
+		expectedPass   string
+		expectedNoAuth bool
+		expectedError  error
+	}{
+		{name: "host entry", url: "https://api.example.com/", flags: map[string]string{"netrc-file": netrcFile}, expectedUser: "alice", expectedPass: `s3cr"et`},
+		{name: "login from URL", url: "https://bob@api.example.com/", flags: map[string]string{"netrc-file": netrcFile}, expectedUser: "bob", expectedPass: "hunter2"},
+		{name: "default entry", url: "https://unknown.example.com/", flags: map[string]string{"netrc-file": netrcFile}, expectedUser: "anonymous", expectedPass: "guest@example.com"},
+		{name: "--user takes precedence", url: "https://api.example.com/", user: "dave:pw", flags: map[string]string{"netrc-file": netrcFile}, expectedUser: "dave", expectedPass: "pw"},
+		{name: "URL credentials take precedence", url: "https://eve:pw@api.example.com/", flags: map[string]string{"netrc-file": netrcFile}, expectedUser: "eve", expectedPass: "pw"},
+		{name: "missing host is an error", url: "https://unknown.example.com/", flags: map[string]string{"netrc-file": noDefault}, expectedError: ErrNetrcNoCredentials},
+		{name: "missing host is ignored when optional", url: "https://unknown.example.com/", flags: map[string]string{"netrc-file": noDefault, "netrc-optional": "true"}, expectedNoAuth: true},
+		{name: "missing file is ignored when optional", url: "https://api.example.com/", flags: map[string]string{"netrc-file": missing, "netrc-optional": "true"}, expectedNoAuth: true},
+		{name: "missing file is an error", url: "https://api.example.com/", flags: map[string]string{"netrc-file": missing, "netrc": "true"}, expectedError: fs.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", tt.url, "")
+			cmd.Flags().String("user", tt.user, "")
+			cmd.Flags().Bool("netrc", false, "")
+			cmd.Flags().Bool("netrc-optional", false, "")
+			cmd.Flags().String("netrc-file", "", "")
+			for name, value := range tt.flags {
+				require.NoError(t, cmd.Flags().Set(name, value))
+			}
+
+			req, err := BuildRequest(cmd, nil)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.expectedNoAuth {
+				assert.Empty(t, req.Header.Get("Authorization"))
+				return
+			}
+			user, pass, ok := req.BasicAuth()
+			assert.True(t, ok)
+			assert.Equal(t, tt.expectedUser, user)
+			assert.Equal(t, tt.expectedPass, pass)
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package cobracurl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // NTLMv2 is defined on HMAC-MD5
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // NTLM hashes passwords with MD4
+)
+
+// NTLM negotiate flags (MS-NLMP section 2.2.2.5).
+const (
+	ntlmNegotiateUnicode                 = 0x00000001
+	ntlmNegotiateOEM                     = 0x00000002
+	ntlmRequestTarget                    = 0x00000004
+	ntlmNegotiateNTLM                    = 0x00000200
+	ntlmNegotiateAlwaysSign              = 0x00008000
+	ntlmNegotiateExtendedSessionSecurity = 0x00080000
+	ntlmNegotiateTargetInfo              = 0x00800000
+	ntlmNegotiate128                     = 0x20000000
+	ntlmNegotiate56                      = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSessionSecurity | ntlmNegotiateTargetInfo |
+		ntlmNegotiate128 | ntlmNegotiate56
+
+	ntlmAvEOL       = 0x0000
+	ntlmAvTimestamp = 0x0007
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ErrInvalidNTLMChallenge is returned when a server sends an NTLM challenge
+// message that cannot be parsed.
+var ErrInvalidNTLMChallenge = errors.New("invalid NTLM challenge message")
+
+// ntlmNegotiateMessage returns the first message of the handshake.
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	// Empty domain and workstation fields point past the header.
+	binary.LittleEndian.PutUint32(msg[20:], 32)
+	binary.LittleEndian.PutUint32(msg[28:], 32)
+	return msg
+}
+
+// ntlmChallenge is the content of the server's challenge message.
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, ErrInvalidNTLMChallenge
+	}
+	c := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(msg[20:]),
+		serverChallenge: msg[24:32],
+	}
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, ErrInvalidNTLMChallenge
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+// timestamp returns the MsvAvTimestamp of the target info, if any.
+func (c *ntlmChallenge) timestamp() ([]byte, bool) {
+	info := c.targetInfo
+	for len(info) >= 4 {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if id == ntlmAvEOL || len(info) < 4+length {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return info[4:12], true
+		}
+		info = info[4+length:]
+	}
+	return nil, false
+}
+
+// ntowfv2 computes the NTLMv2 response key of MS-NLMP section 3.3.2.
+func ntowfv2(username, password, domain string) []byte {
+	h := md4.New()
+	h.Write(utf16le(password))
+	return hmacMD5(h.Sum(nil), utf16le(strings.ToUpper(username)+domain))
+}
+
+// ntlmv2Responses computes the NT and LM challenge responses for c with the
+// given client challenge and FILETIME timestamp.
+func ntlmv2Responses(responseKey []byte, c *ntlmChallenge, clientChallenge, timestamp []byte) ([]byte, []byte) {
+	var temp bytes.Buffer
+	temp.Write([]byte{1, 1, 0, 0, 0, 0, 0, 0})
+	temp.Write(timestamp)
+	temp.Write(clientChallenge)
+	temp.Write([]byte{0, 0, 0, 0})
+	temp.Write(c.targetInfo)
+	temp.Write([]byte{0, 0, 0, 0})
+
+	ntProof := hmacMD5(responseKey, c.serverChallenge, temp.Bytes())
+	nt := append(ntProof, temp.Bytes()...)
+	lm := append(hmacMD5(responseKey, c.serverChallenge, clientChallenge), clientChallenge...)
+	return nt, lm
+}
+
+// ntlmAuthenticateMessage returns the last message of the handshake.
+// username may be given as DOMAIN\user.
+func ntlmAuthenticateMessage(c *ntlmChallenge, username, password string, clientChallenge []byte, now time.Time) []byte {
+	var domain string
+	if d, u, ok := strings.Cut(username, `\`); ok {
+		domain, username = d, u
+	}
+
+	timestamp, serverTime := c.timestamp()
+	if !serverTime {
+		timestamp = make([]byte, 8)
+		// FILETIME counts 100ns intervals since 1601-01-01.
+		binary.LittleEndian.PutUint64(timestamp, uint64(now.UnixNano()/100+116444736000000000)) //nolint:gosec
+	}
+
+	nt, lm := ntlmv2Responses(ntowfv2(username, password, domain), c, clientChallenge, timestamp)
+	if serverTime {
+		// With a server timestamp the LMv2 response must be zeroes.
+		lm = make([]byte, 24)
+	}
+
+	flags := ntlmNegotiateFlags &^ uint32(ntlmNegotiateOEM)
+	fields := [][]byte{lm, nt, utf16le(domain), utf16le(username), nil, nil}
+
+	const headerLen = 64
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := headerLen
+	for i, field := range fields {
+		pos := 12 + 8*i
+		binary.LittleEndian.PutUint16(msg[pos:], uint16(len(field)))   //nolint:gosec
+		binary.LittleEndian.PutUint16(msg[pos+2:], uint16(len(field))) //nolint:gosec
+		binary.LittleEndian.PutUint32(msg[pos+4:], uint32(offset))     //nolint:gosec
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], flags)
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+	return msg
+}
+
+func utf16le(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// ntlmToken returns the NTLM token of the challenge headers, if any. A bare
+// "NTLM" challenge yields an empty, non-nil token.
+func ntlmToken(values []string) ([]byte, bool) {
+	for _, c := range parseAuthChallenges(values) {
+		if !strings.EqualFold(c.Scheme, "NTLM") {
+			continue
+		}
+		token, err := base64.StdEncoding.DecodeString(c.Token)
+		if err != nil {
+			return nil, false
+		}
+		return token, true
+	}
+	return nil, false
+}
+
+func newClientChallenge() []byte {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return b
+}
+
+// ntlmTransport performs the NTLM handshake with an origin answering 401,
+// or with a proxy answering 407 when proxy is set. NTLM authenticates the
+// connection, so the requests to a host are serialized to keep their
+// messages on one keep-alive connection, and hosts already authenticated are
+// sent requests without a new handshake. Requests to other hosts are not
+// held up.
+type ntlmTransport struct {
+	credentials credentialsFunc
+	trusted     bool
+	proxy       bool
+	next        http.RoundTripper
+
+	mu    sync.Mutex
+	hosts map[string]*ntlmHost
+}
+
+// ntlmHost is the handshake state of the connection to one host. Its mutex
+// is held for the whole round trip.
+type ntlmHost struct {
+	mu            sync.Mutex
+	authenticated bool
+}
+
+func newNTLMTransport(credentials credentialsFunc, trusted, proxy bool, next http.RoundTripper) *ntlmTransport {
+	return &ntlmTransport{
+		credentials: credentials,
+		trusted:     trusted,
+		proxy:       proxy,
+		next:        next,
+		hosts:       map[string]*ntlmHost{},
+	}
+}
+
+func (t *ntlmTransport) host(key string) *ntlmHost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	host, ok := t.hosts[key]
+	if !ok {
+		host = &ntlmHost{}
+		t.hosts[key] = host
+	}
+	return host
+}
+
+func (t *ntlmTransport) headers() (status int, challenge, authorization string) {
+	if t.proxy {
+		return http.StatusProxyAuthRequired, "Proxy-Authenticate", "Proxy-Authorization"
+	}
+	return http.StatusUnauthorized, "WWW-Authenticate", "Authorization"
+}
+
+func (t *ntlmTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	username, password, ok := t.credentials(req.URL)
+	if !ok || !t.proxy && !authAllowed(req, t.trusted) || t.proxy && req.URL.Scheme != "http" {
+		return t.next.RoundTrip(req)
+	}
+
+	req, err := replayableRequest(withoutUserinfo(req))
+	if err != nil {
+		return nil, err
+	}
+	status, challengeHeader, authorizationHeader := t.headers()
+
+	host := t.host(req.URL.Host)
+	host.mu.Lock()
+	defer host.mu.Unlock()
+
+	if host.authenticated {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || resp.StatusCode != status {
+			return resp, err
+		}
+		if _, ok := ntlmToken(resp.Header.Values(challengeHeader)); !ok {
+			return resp, nil
+		}
+		// The authenticated connection is gone; start over on a new one.
+		discardResponse(resp)
+		host.authenticated = false
+		if req, err = rewindBody(req); err != nil {
+			return nil, err
+		}
+	}
+
+	negotiate := req.Clone(req.Context())
+	negotiate.Header.Set(authorizationHeader, "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	resp, err := t.next.RoundTrip(negotiate)
+	if err != nil || resp.StatusCode != status {
+		return resp, err
+	}
+	token, ok := ntlmToken(resp.Header.Values(challengeHeader))
+	if !ok || len(token) == 0 {
+		return resp, nil
+	}
+	challenge, err := parseNTLMChallenge(token)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	discardResponse(resp)
+
+	authenticate, err := rewindBody(req)
+	if err != nil {
+		return nil, err
+	}
+	msg := ntlmAuthenticateMessage(challenge, username, password, newClientChallenge(), time.Now())
+	authenticate.Header.Set(authorizationHeader, "NTLM "+base64.StdEncoding.EncodeToString(msg))
+	resp, err = t.next.RoundTrip(authenticate)
+	if err == nil && resp.StatusCode != status {
+		host.authenticated = true
+	}
+	return resp, err
+}
+
+func (t *ntlmTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// ntlmProxyDialer returns a DialContext that opens CONNECT tunnels through
+// proxyURL, authenticating with NTLM. Connections to the proxy itself, used
+// for plain HTTP requests, are dialed as is.
+func ntlmProxyDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error), proxyURL *url.URL, username, password string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	proxyAddr := canonicalAddr(proxyURL)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, proxyAddr)
+		if err != nil || addr == proxyAddr {
+			return conn, err
+		}
+		if err := ntlmConnectTunnel(conn, addr, username, password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// ntlmConnectTunnel asks the proxy on conn to open a tunnel to addr,
+// running the NTLM handshake over the CONNECT requests.
+func ntlmConnectTunnel(conn net.Conn, addr, username, password string) error {
+	br := bufio.NewReader(conn)
+	connect := func(authorization string) (*http.Response, error) {
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: http.Header{"Proxy-Authorization": {authorization}},
+		}
+		if err := req.Write(conn); err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(br, req)
+		if err != nil || resp.StatusCode == http.StatusOK {
+			// The tunnel starts right after a successful response.
+			return resp, err
+		}
+		// Drain the rejection so that the handshake goes on on conn.
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp, err
+	}
+
+	resp, err := connect("NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	token, ok := ntlmToken(resp.Header.Values("Proxy-Authenticate"))
+	if resp.StatusCode != http.StatusProxyAuthRequired || !ok || len(token) == 0 {
+		return fmt.Errorf("proxy CONNECT to %s failed: %s", addr, resp.Status)
+	}
+	challenge, err := parseNTLMChallenge(token)
+	if err != nil {
+		return err
+	}
+
+	msg := ntlmAuthenticateMessage(challenge, username, password, newClientChallenge(), time.Now())
+	if resp, err = connect("NTLM " + base64.StdEncoding.EncodeToString(msg)); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT to %s failed: %s", addr, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package cobracurl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNTLMv2ResponsesMSNLMP(t *testing.T) {
+	// Example of MS-NLMP section 4.2.4.
+	targetInfo, _ := hex.DecodeString("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+
+	key := ntowfv2("User", "Password", "Domain")
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(key))
+
+	nt, lm := ntlmv2Responses(key, &ntlmChallenge{serverChallenge: serverChallenge, targetInfo: targetInfo}, clientChallenge, make([]byte, 8))
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(nt[:16]))
+	assert.Equal(t, "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa", hex.EncodeToString(lm))
+}
+
+func TestParseNTLMChallenge(t *testing.T) {
+	msg := ntlmTestChallenge([]byte("12345678"), true)
+	c, err := parseNTLMChallenge(msg)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345678"), c.serverChallenge)
+	timestamp, ok := c.timestamp()
+	assert.True(t, ok)
+	assert.Len(t, timestamp, 8)
+
+	_, err = parseNTLMChallenge(ntlmNegotiateMessage())
+	assert.ErrorIs(t, err, ErrInvalidNTLMChallenge)
+	_, err = parseNTLMChallenge(msg[:40])
+	assert.NoError(t, err)
+	_, err = parseNTLMChallenge(append(msg[:44:44], 0xff, 0, 0, 0))
+	assert.ErrorIs(t, err, ErrInvalidNTLMChallenge)
+}
+
+// ntlmTestChallenge returns a challenge message, with a timestamp in the
+// target info when timestamp is set.
+func ntlmTestChallenge(serverChallenge []byte, timestamp bool) []byte {
+	info := binary.LittleEndian.AppendUint16(nil, 2)
+	info = binary.LittleEndian.AppendUint16(info, uint16(len(utf16le("TEST"))))
+	info = append(info, utf16le("TEST")...)
+	if timestamp {
+		info = binary.LittleEndian.AppendUint16(info, ntlmAvTimestamp)
+		info = binary.LittleEndian.AppendUint16(info, 8)
+		info = binary.LittleEndian.AppendUint64(info, uint64(time.Now().UnixNano()/100+116444736000000000))
+	}
+	info = append(info, 0, 0, 0, 0)
+
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[16:], 48)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmNegotiateFlags)
+	copy(msg[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(info)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(info)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return append(msg, info...)
+}
+
+// ntlmTestConn is the handshake state of one connection to a fake NTLM
+// server.
+type ntlmTestConn struct {
+	serverChallenge []byte
+	authenticated   bool
+}
+
+type ntlmTestConnKey struct{}
+
+// ntlmTestHandshake runs the server side of the handshake for the
+// Authorization value on conn and returns the challenge to send back, or ""
+// once the NTLMv2 response of TEST\user:secret has been verified.
+func ntlmTestHandshake(conn *ntlmTestConn, authorization string) string {
+	if conn.authenticated {
+		return ""
+	}
+	msg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "NTLM "))
+	if err != nil || len(msg) < 12 || !strings.HasPrefix(authorization, "NTLM ") {
+		return "NTLM"
+	}
+
+	switch binary.LittleEndian.Uint32(msg[8:]) {
+	case 1:
+		conn.serverChallenge = []byte("\x01\x02\x03\x04\x05\x06\x07\x08")
+		return "NTLM " + base64.StdEncoding.EncodeToString(ntlmTestChallenge(conn.serverChallenge, true))
+	case 3:
+		if conn.serverChallenge == nil || len(msg) < 64 {
+			return "NTLM"
+		}
+		field := func(i int) []byte {
+			pos := 12 + 8*i
+			length := int(binary.LittleEndian.Uint16(msg[pos:]))
+			offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+			return msg[offset : offset+length]
+		}
+		nt, domain, user := field(1), field(2), field(3)
+		key := ntowfv2("user", "secret", "TEST")
+		if !bytes.Equal(domain, utf16le("TEST")) || !bytes.Equal(user, utf16le("user")) || len(nt) < 16 ||
+			!bytes.Equal(nt[:16], hmacMD5(key, conn.serverChallenge, nt[16:])) {
+			return "NTLM"
+		}
+		conn.authenticated = true
+		return ""
+	}
+	return "NTLM"
+}
+
+// newNTLMServer answers requests on connections that have not completed an
+// NTLM handshake with 401 and the unauthorized body, and counts the
+// connections accepted.
+func newNTLMServer(t *testing.T, conns *atomic.Int32, unauthorized string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		conn := r.Context().Value(ntlmTestConnKey{}).(*ntlmTestConn)
+		if challenge := ntlmTestHandshake(conn, r.Header.Get("Authorization")); challenge != "" {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, unauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("authenticated " + string(body)))
+	}))
+	srv.Config.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+		conns.Add(1)
+		return context.WithValue(ctx, ntlmTestConnKey{}, &ntlmTestConn{})
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBuildClientNTLM(t *testing.T) {
+	var conns atomic.Int32
+	srv := newNTLMServer(t, &conns, "unauthorized")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", srv.URL+"/private", "")
+	cmd.Flags().String("user", `TEST\user:secret`, "")
+	cmd.Flags().Bool("ntlm", true, "")
+	cmd.Flags().String("data", "payload", "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	for range 2 {
+		req, err := BuildRequest(cmd, nil)
+		require.NoError(t, err)
+		assert.Empty(t, req.Header.Get("Authorization"))
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "authenticated payload", string(body))
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestBuildClientNTLMLargeChallengeBody(t *testing.T) {
+	var conns atomic.Int32
+	srv := newNTLMServer(t, &conns, strings.Repeat("unauthorized\n", 100_000))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("user", `TEST\user:secret`, "")
+	cmd.Flags().Bool("ntlm", true, "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestBuildClientNTLMHostsNotSerialized(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(slow.Close)
+	t.Cleanup(func() { close(release) })
+	var conns atomic.Int32
+	srv := newNTLMServer(t, &conns, "unauthorized")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("user", `TEST\user:secret`, "")
+	cmd.Flags().Bool("ntlm", true, "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	go func() {
+		if resp, err := client.Get(slow.URL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestBuildClientNTLMRequiresKeepAlive(t *testing.T) {
+	flags := []string{"http1.0", "raw", "no-keepalive", "http2", "http2-prior-knowledge", "http3", "http3-only"}
+	for _, flag := range flags {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("user", `TEST\user:secret`, "")
+		cmd.Flags().Bool("ntlm", true, "")
+		cmd.Flags().Bool(flag, true, "")
+
+		_, err := BuildClient(cmd)
+		assert.Error(t, err, flag)
+	}
+	for _, flag := range flags {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("proxy", "http://127.0.0.1:3128", "")
+		cmd.Flags().String("proxy-user", `TEST\user:secret`, "")
+		cmd.Flags().Bool("proxy-ntlm", true, "")
+		cmd.Flags().Bool(flag, true, "")
+
+		_, err := BuildClient(cmd)
+		assert.Error(t, err, "proxy-ntlm "+flag)
+	}
+}
+
+func TestBuildClientNTLMAltSvcWithoutHTTP3(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("user", `TEST\user:secret`, "")
+	cmd.Flags().Bool("ntlm", true, "")
+	cmd.Flags().String("alt-svc", filepath.Join(t.TempDir(), "alt-svc.txt"), "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	ntlm, ok := client.Transport.(*ntlmTransport)
+	require.True(t, ok)
+	altSvc, ok := ntlm.next.(*altSvcTransport)
+	require.True(t, ok)
+	assert.Nil(t, altSvc.h3)
+}
+
+func TestBuildClientNTLMWrongPassword(t *testing.T) {
+	var conns atomic.Int32
+	srv := newNTLMServer(t, &conns, "unauthorized")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("user", `TEST\user:wrong`, "")
+	cmd.Flags().Bool("ntlm", true, "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// newNTLMProxy is a proxy requiring NTLM. It answers plain HTTP requests
+// itself and tunnels CONNECT requests to their target.
+func newNTLMProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := r.Context().Value(ntlmTestConnKey{}).(*ntlmTestConn)
+		if challenge := ntlmTestHandshake(conn, r.Header.Get("Proxy-Authorization")); challenge != "" {
+			w.Header().Set("Proxy-Authenticate", challenge)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			_, _ = w.Write([]byte("proxy authentication required"))
+			return
+		}
+		if r.Method != http.MethodConnect {
+			_, _ = w.Write([]byte("proxied " + r.URL.String()))
+			return
+		}
+
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		client, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		_, _ = client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(target, buf)
+			target.Close()
+		}()
+		_, _ = io.Copy(client, target)
+		client.Close()
+	}))
+	proxy.Config.ConnContext = func(ctx context.Context, _ net.Conn) context.Context {
+		return context.WithValue(ctx, ntlmTestConnKey{}, &ntlmTestConn{})
+	}
+	proxy.Start()
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+func TestBuildClientProxyNTLM(t *testing.T) {
+	proxy := newNTLMProxy(t)
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Proxy-Authorization"))
+		_, _ = w.Write([]byte("tunneled"))
+	}))
+	t.Cleanup(origin.Close)
+
+	tests := []struct {
+		name         string
+		proxy        string
+		proxyUser    string
+		url          string
+		expectedBody string
+	}{
+		{
+			name:         "HTTP request with proxy-user",
+			proxy:        proxy.URL,
+			proxyUser:    `TEST\user:secret`,
+			url:          "http://origin.example/path",
+			expectedBody: "proxied http://origin.example/path",
+		},
+		{
+			name:         "HTTP request with proxy URL credentials",
+			proxy:        strings.Replace(proxy.URL, "http://", `http://TEST%5Cuser:secret@`, 1),
+			url:          "http://origin.example/path",
+			expectedBody: "proxied http://origin.example/path",
+		},
+		{
+			name:         "HTTPS request through a tunnel",
+			proxy:        proxy.URL,
+			proxyUser:    `TEST\user:secret`,
+			url:          origin.URL,
+			expectedBody: "tunneled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("proxy", tt.proxy, "")
+			cmd.Flags().String("proxy-user", tt.proxyUser, "")
+			cmd.Flags().Bool("proxy-ntlm", true, "")
+			cmd.Flags().Bool("insecure", true, "")
+
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			for range 2 {
+				resp, err := client.Get(tt.url)
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				require.NoError(t, err)
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestBuildClientProxyNTLMWrongPassword(t *testing.T) {
+	proxy := newNTLMProxy(t)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("proxy", proxy.URL, "")
+	cmd.Flags().String("proxy-user", `TEST\user:wrong`, "")
+	cmd.Flags().Bool("proxy-ntlm", true, "")
+
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	resp, err := client.Get("http://origin.example/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+
+	_, err = client.Get("https://origin.example/")
+	assert.ErrorContains(t, err, "407")
+}
@@ -0,0 +1,93 @@
+package cobracurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// ErrNoTerminal is returned when --user has no password and there is no
+// terminal to prompt for it on.
+var ErrNoTerminal = errors.New("cannot prompt for password: stdin is not a terminal")
+
+// PasswordPrompter asks for the password of username.
+type PasswordPrompter func(username string) (string, error)
+
+type passwordPrompterKey struct{}
+
+// WithPasswordPrompter returns a copy of ctx that makes BuildRequest and
+// BuildClient use prompt instead of the terminal when --user has no
+// password. Set it on the command with cmd.SetContext.
+func WithPasswordPrompter(ctx context.Context, prompt PasswordPrompter) context.Context {
+	return context.WithValue(ctx, passwordPrompterKey{}, prompt)
+}
+
+// passwordPrompterFromContext returns the prompter attached to ctx, or one
+// reading from the terminal.
+func passwordPrompterFromContext(ctx context.Context) PasswordPrompter {
+	if ctx != nil {
+		if prompt, ok := ctx.Value(passwordPrompterKey{}).(PasswordPrompter); ok {
+			return prompt
+		}
+	}
+	return terminalPasswordPrompter
+}
+
+type promptedPasswordsKey struct{}
+
+// promptedPasswords keeps the passwords prompted for on a command, by login.
+type promptedPasswords struct {
+	mu        sync.Mutex
+	passwords map[string]string
+}
+
+// promptedPassword returns the password prompted for login on cmd. When
+// there is none yet and prompt is set, it prompts and keeps the answer in
+// the command context, never in the --user flag; otherwise it returns false.
+func promptedPassword(cmd *cobra.Command, login string, prompt bool) (string, bool, error) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	passwords, ok := ctx.Value(promptedPasswordsKey{}).(*promptedPasswords)
+	if !ok {
+		if !prompt {
+			return "", false, nil
+		}
+		passwords = &promptedPasswords{passwords: map[string]string{}}
+		cmd.SetContext(context.WithValue(ctx, promptedPasswordsKey{}, passwords))
+	}
+
+	passwords.mu.Lock()
+	defer passwords.mu.Unlock()
+	if password, ok := passwords.passwords[login]; ok || !prompt {
+		return password, ok, nil
+	}
+	password, err := passwordPrompterFromContext(ctx)(login)
+	if err != nil {
+		return "", false, err
+	}
+	passwords.passwords[login] = password
+	return password, true, nil
+}
+
+// terminalPasswordPrompter reads the password from stdin without echo, like
+// curl does.
+func terminalPasswordPrompter(username string) (string, error) {
+	fd := int(os.Stdin.Fd()) //nolint:gosec // file descriptors fit in an int
+	if !term.IsTerminal(fd) {
+		return "", ErrNoTerminal
+	}
+	fmt.Fprintf(os.Stderr, "Enter host password for user '%s':", username)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return string(password), nil
+}
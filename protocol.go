@@ -0,0 +1,153 @@
+package cobracurl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// KnownProtocols lists the protocol names curl understands in --proto,
+// --proto-redir and --proto-default.
+var KnownProtocols = []string{
+	"dict", "file", "ftp", "ftps", "gopher", "gophers", "http", "https",
+	"imap", "imaps", "ldap", "ldaps", "mqtt", "pop3", "pop3s", "rtmp",
+	"rtsp", "scp", "sftp", "smb", "smbs", "smtp", "smtps", "telnet", "tftp",
+	"ws", "wss",
+}
+
+// DefaultRedirectProtocols is curl's default --proto-redir set.
+var DefaultRedirectProtocols = []string{"http", "https", "ftp", "ftps"}
+
+// DefaultProtocol is the scheme assumed for URLs without one when
+// --proto-default is not set.
+const DefaultProtocol = "http"
+
+var ErrUnsupportedProtocol = errors.New("protocol not supported or disabled")
+
+// ProtocolSet is a set of allowed lower-case URL schemes.
+type ProtocolSet map[string]bool
+
+// NewProtocolSet returns a set containing the given protocols.
+func NewProtocolSet(protocols ...string) ProtocolSet {
+	set := make(ProtocolSet, len(protocols))
+	for _, p := range protocols {
+		set[strings.ToLower(p)] = true
+	}
+	return set
+}
+
+// Allows reports whether scheme is part of the set.
+func (p ProtocolSet) Allows(scheme string) bool {
+	return p[strings.ToLower(scheme)]
+}
+
+// ParseProtocols applies a curl-style protocol list such as "=http,https" or
+// "-all,+https" to base and returns the resulting set. Tokens are processed
+// left to right: "+" (the default) adds, "-" removes and "=" replaces the set.
+// The name "all" stands for every known protocol. Unknown protocol names are
+// ignored, as curl does.
+func ParseProtocols(spec string, base ProtocolSet) ProtocolSet {
+	set := make(ProtocolSet, len(base))
+	for p, ok := range base {
+		if ok {
+			set[p] = true
+		}
+	}
+
+	for _, token := range strings.Split(spec, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+
+		action := byte('+')
+		for token != "" && strings.IndexByte("+-=", token[0]) >= 0 {
+			action = token[0]
+			token = token[1:]
+		}
+
+		var names []string
+		if name := strings.ToLower(token); name == "all" {
+			names = KnownProtocols
+		} else if isKnownProtocol(name) {
+			names = []string{name}
+		}
+
+		switch action {
+		case '=':
+			set = NewProtocolSet(names...)
+		case '-':
+			for _, name := range names {
+				delete(set, name)
+			}
+		default:
+			for _, name := range names {
+				set[name] = true
+			}
+		}
+	}
+
+	return set
+}
+
+func isKnownProtocol(name string) bool {
+	for _, p := range KnownProtocols {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildProtocols reads --proto and --proto-redir and returns the protocols
+// allowed for the initial request and for redirects.
+func BuildProtocols(cmd *cobra.Command) (allowed ProtocolSet, redirect ProtocolSet) {
+	allowed = NewProtocolSet(KnownProtocols...)
+	if spec, _ := cmd.Flags().GetString("proto"); spec != "" {
+		allowed = ParseProtocols(spec, allowed)
+	}
+
+	redirect = NewProtocolSet(DefaultRedirectProtocols...)
+	if spec, _ := cmd.Flags().GetString("proto-redir"); spec != "" {
+		redirect = ParseProtocols(spec, redirect)
+	}
+
+	return allowed, redirect
+}
+
+// applyDefaultProtocol prefixes rawURL with the --proto-default scheme (or
+// DefaultProtocol) when it has none.
+func applyDefaultProtocol(cmd *cobra.Command, rawURL string) (string, error) {
+	if urlScheme(rawURL) != "" {
+		return rawURL, nil
+	}
+
+	scheme := DefaultProtocol
+	if protoDefault, _ := cmd.Flags().GetString("proto-default"); protoDefault != "" {
+		scheme = strings.ToLower(protoDefault)
+		if !isKnownProtocol(scheme) {
+			return "", fmt.Errorf("%w: unknown --proto-default %q", ErrUnsupportedProtocol, protoDefault)
+		}
+	}
+
+	return scheme + "://" + rawURL, nil
+}
+
+// urlScheme returns the scheme of rawURL if it starts with "scheme://".
+func urlScheme(rawURL string) string {
+	idx := strings.Index(rawURL, "://")
+	if idx <= 0 {
+		return ""
+	}
+	scheme := rawURL[:idx]
+	for i, c := range scheme {
+		isAlpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if isAlpha || (i > 0 && ((c >= '0' && c <= '9') || c == '+' || c == '-' || c == '.')) {
+			continue
+		}
+		return ""
+	}
+	return strings.ToLower(scheme)
+}
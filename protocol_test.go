@@ -0,0 +1,130 @@
+package cobracurl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProtocols(t *testing.T) {
+	tests := []struct {
+		spec    string
+		base    ProtocolSet
+		allowed []string
+		denied  []string
+	}{
+		{"=http,https", NewProtocolSet(KnownProtocols...), []string{"http", "https"}, []string{"ftp", "file"}},
+		{"-all,+https", NewProtocolSet(KnownProtocols...), []string{"https"}, []string{"http", "ftp"}},
+		{"-ftp", NewProtocolSet("http", "ftp"), []string{"http"}, []string{"ftp"}},
+		{"https", NewProtocolSet("http"), []string{"http", "https"}, nil},
+		{"=HTTPS", NewProtocolSet("http"), []string{"https"}, []string{"http"}},
+		{"=https,bogus", NewProtocolSet("http"), []string{"https"}, []string{"http", "bogus"}},
+		{"", NewProtocolSet("http"), []string{"http"}, []string{"https"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			set := ParseProtocols(tt.spec, tt.base)
+			for _, p := range tt.allowed {
+				assert.True(t, set.Allows(p), "%q should be allowed", p)
+			}
+			for _, p := range tt.denied {
+				assert.False(t, set.Allows(p), "%q should be denied", p)
+			}
+		})
+	}
+}
+
+func TestBuildRequestProtocols(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		proto       string
+		protoDef    string
+		expectedURL string
+		expectedErr error
+	}{
+		{name: "URL without scheme defaults to http", url: "example.com/path", expectedURL: "http://example.com/path"},
+		{name: "proto-default supplies scheme", url: "example.com", protoDef: "https", expectedURL: "https://example.com"},
+		{name: "proto-default ignored when scheme present", url: "http://example.com", protoDef: "https", expectedURL: "http://example.com"},
+		{name: "unknown proto-default", url: "example.com", protoDef: "gopherz", expectedErr: ErrUnsupportedProtocol},
+		{name: "proto allows https", url: "https://example.com", proto: "=https", expectedURL: "https://example.com"},
+		{name: "proto rejects http", url: "http://example.com", proto: "=https", expectedErr: ErrUnsupportedProtocol},
+		{name: "proto rejects defaulted scheme", url: "example.com", proto: "-all,+https", expectedErr: ErrUnsupportedProtocol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", tt.url, "")
+			cmd.Flags().String("proto", tt.proto, "")
+			cmd.Flags().String("proto-default", tt.protoDef, "")
+
+			req, err := BuildRequest(cmd, nil)
+			if tt.expectedErr != nil {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, tt.expectedErr))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedURL, req.URL.String())
+		})
+	}
+}
+
+func TestBuildClientProtoRedir(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	t.Run("redirect to allowed scheme is followed", func(t *testing.T) {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("location", true, "")
+		cmd.Flags().String("proto-redir", "=http", "")
+
+		client, err := BuildClient(cmd)
+		require.NoError(t, err)
+
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("redirect to disallowed scheme is refused", func(t *testing.T) {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("location", true, "")
+		cmd.Flags().String("proto-redir", "=https", "")
+
+		client, err := BuildClient(cmd)
+		require.NoError(t, err)
+
+		_, err = client.Get(srv.URL)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrUnsupportedProtocol)
+	})
+
+	t.Run("redirect outside --proto is refused", func(t *testing.T) {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("location", true, "")
+		cmd.Flags().String("proto", "-http", "")
+
+		client, err := BuildClient(cmd)
+		require.NoError(t, err)
+
+		_, err = client.Get(srv.URL)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrUnsupportedProtocol)
+	})
+}
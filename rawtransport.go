@@ -0,0 +1,423 @@
+package cobracurl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+)
+
+// ErrHTTP09NotAllowed is returned when a server answers with a header-less
+// HTTP/0.9 response and --http0.9 is not set.
+var ErrHTTP09NotAllowed = errors.New("received HTTP/0.9 when not allowed")
+
+// http09DialContext wraps dial so that the header-less HTTP/0.9 responses
+// read by http.Transport fail with ErrHTTP09NotAllowed or, when allow is
+// set, are given an "HTTP/0.9 200 OK" head that net/http can parse. Other
+// responses keep the connection and its reuse untouched.
+func http09DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error), allow bool) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &http09Conn{Conn: conn, allow: allow}, nil
+	}
+}
+
+// http09Conn checks the first response read on a connection whose first
+// write is an HTTP/1.x request. TLS and HTTP/2 connections are left alone.
+type http09Conn struct {
+	net.Conn
+	allow   bool
+	request atomic.Int32 // 0 before the first write, 1 for HTTP/1.x, 2 otherwise
+
+	checked bool
+	pending []byte
+}
+
+func (c *http09Conn) Write(p []byte) (int, error) {
+	if len(p) > 0 && c.request.Load() == 0 {
+		kind := int32(2)
+		if isHTTP1Request(p) {
+			kind = 1
+		}
+		c.request.CompareAndSwap(0, kind)
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *http09Conn) Read(p []byte) (int, error) {
+	if !c.checked {
+		// The server answers once the request is written, so the first
+		// read settles the kind of connection.
+		var head [len("HTTP/")]byte
+		n, err := io.ReadFull(c.Conn, head[:])
+		if n == 0 {
+			return 0, err
+		}
+		c.checked = true
+		c.pending = head[:n]
+		if c.request.Load() == 1 && string(c.pending) != "HTTP/" {
+			if !c.allow {
+				return 0, ErrHTTP09NotAllowed
+			}
+			c.pending = append([]byte("HTTP/0.9 200 OK\r\n\r\n"), c.pending...)
+		}
+	}
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+// isHTTP1Request reports whether p starts with an HTTP/1.x request line,
+// rather than a TLS handshake or the HTTP/2 connection preface.
+func isHTTP1Request(p []byte) bool {
+	method, _, ok := bytes.Cut(p, []byte(" "))
+	if !ok || len(method) == 0 || string(method) == "PRI" {
+		return false
+	}
+	for _, c := range method {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// rawTransport is a minimal HTTP/1.x round tripper that writes the request
+// line itself, for modes net/http cannot express such as HTTP/1.0 request
+// lines, HTTP/0.9 responses or undecoded bodies. It opens a new connection
+// for every request.
+type rawTransport struct {
+	DialContext     func(ctx context.Context, network, addr string) (net.Conn, error)
+	TLSClientConfig *tls.Config
+	Proxy           func(*http.Request) (*url.URL, error)
+	ProtoMajor      int
+	ProtoMinor      int
+	// AllowHTTP09 accepts responses without a status line and headers.
+	AllowHTTP09 bool
+	// Raw leaves chunked transfer encoding in the response body.
+	Raw bool
+}
+
+// newRawTransport returns a rawTransport sharing the dialer, TLS and proxy
+// settings of t.
+func newRawTransport(t *http.Transport, major, minor int) *rawTransport {
+	return &rawTransport{
+		DialContext:     t.DialContext,
+		TLSClientConfig: t.TLSClientConfig,
+		Proxy:           t.Proxy,
+		ProtoMajor:      major,
+		ProtoMinor:      minor,
+	}
+}
+
+func (t *rawTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	conn, target, proxyAuth, err := t.connect(ctx, req)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	if err := t.writeRequest(conn, req, target, proxyAuth); err != nil {
+		return fail(err)
+	}
+
+	resp, err := t.readResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return fail(err)
+	}
+	resp.Body = &connBody{ReadCloser: resp.Body, conn: conn, stop: stop}
+	return resp, nil
+}
+
+// connect dials the origin, or the proxy when one applies, and returns the
+// connection together with the request target and Proxy-Authorization value
+// to write.
+func (t *rawTransport) connect(ctx context.Context, req *http.Request) (net.Conn, string, string, error) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	addr := canonicalAddr(req.URL)
+	target := req.URL.RequestURI()
+
+	var proxyURL *url.URL
+	if t.Proxy != nil {
+		u, err := t.Proxy(req)
+		if err != nil {
+			return nil, "", "", err
+		}
+		proxyURL = u
+	}
+
+	var conn net.Conn
+	var err error
+	switch {
+	case proxyURL == nil:
+		conn, err = dial(ctx, "tcp", addr)
+	case proxyURL.Scheme != "http":
+		return nil, "", "", fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	default:
+		conn, err = dial(ctx, "tcp", canonicalAddr(proxyURL))
+		if err == nil && req.URL.Scheme == "https" {
+			err = connectTunnel(conn, addr, proxyURL)
+		} else if err == nil {
+			target = absoluteTarget(req.URL)
+		}
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, "", "", err
+	}
+
+	if req.URL.Scheme == "https" {
+		cfg := &tls.Config{} //nolint:gosec
+		if t.TLSClientConfig != nil {
+			cfg = t.TLSClientConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = req.URL.Hostname()
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, "", "", err
+		}
+		conn = tlsConn
+	}
+
+	var proxyAuth string
+	if proxyURL != nil && req.URL.Scheme == "http" && proxyURL.User != nil {
+		proxyAuth = proxyAuthorization(proxyURL)
+	}
+
+	return conn, target, proxyAuth, nil
+}
+
+func (t *rawTransport) writeRequest(conn net.Conn, req *http.Request, target, proxyAuth string) error {
+	major, minor := t.ProtoMajor, t.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+
+	body, contentLength, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		defer body.Close()
+	}
+
+	header := req.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Host")
+	if proxyAuth != "" {
+		header.Set("Proxy-Authorization", proxyAuth)
+	}
+	if body != nil || contentLength > 0 {
+		header.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+	}
+	if (major > 1 || minor > 0) && header.Get("Connection") == "" {
+		header.Set("Connection", "close")
+	}
+
+	host := req.Host
+	if h := req.Header.Get("Host"); h != "" {
+		host = h
+	}
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	bw := bufio.NewWriter(conn)
+	fmt.Fprintf(bw, "%s %s HTTP/%d.%d\r\n", req.Method, target, major, minor)
+	fmt.Fprintf(bw, "Host: %s\r\n", host)
+	if err := header.Write(bw); err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("\r\n"); err != nil {
+		return err
+	}
+	if body != nil {
+		if _, err := io.Copy(bw, body); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readResponse reads the response to req from br, taking HTTP/0.9 and raw
+// mode into account.
+func (t *rawTransport) readResponse(br *bufio.Reader, req *http.Request) (*http.Response, error) {
+	prefix, err := br.Peek(len("HTTP/"))
+	if len(prefix) == 0 {
+		return nil, err
+	}
+	if string(prefix) != "HTTP/" {
+		if !t.AllowHTTP09 {
+			return nil, ErrHTTP09NotAllowed
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/0.9",
+			ProtoMajor:    0,
+			ProtoMinor:    9,
+			Header:        http.Header{},
+			Body:          io.NopCloser(br),
+			ContentLength: -1,
+			Close:         true,
+			Request:       req,
+		}, nil
+	}
+
+	if !t.Raw {
+		return http.ReadResponse(br, req)
+	}
+
+	// Reading the head as a HEAD response leaves the body in br untouched.
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodHead})
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	noBody := req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent ||
+		resp.StatusCode == http.StatusNotModified || resp.StatusCode < 200
+	switch {
+	case noBody:
+		resp.Body = http.NoBody
+	case resp.ContentLength >= 0 && len(resp.TransferEncoding) == 0:
+		resp.Body = io.NopCloser(io.LimitReader(br, resp.ContentLength))
+	default:
+		resp.Body = io.NopCloser(br)
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+// requestBody returns the request body and its length. Bodies of unknown
+// length are buffered, since the raw transport never uses chunked encoding.
+func requestBody(req *http.Request) (io.ReadCloser, int64, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, 0, nil
+	}
+	if req.ContentLength > 0 {
+		return req.Body, req.ContentLength, nil
+	}
+	defer req.Body.Close()
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), nil
+}
+
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// connectTunnel asks an HTTP proxy to open a tunnel to addr.
+func connectTunnel(conn net.Conn, addr string, proxyURL *url.URL) error {
+	connectReq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		connectReq.Header.Set("Proxy-Authorization", proxyAuthorization(proxyURL))
+	}
+	if err := connectReq.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy CONNECT to %s failed: %s", addr, resp.Status)
+	}
+	return nil
+}
+
+func proxyAuthorization(proxyURL *url.URL) string {
+	password, _ := proxyURL.User.Password()
+	credentials := proxyURL.User.Username() + ":" + password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// absoluteTarget returns the absolute-form request target for u, without
+// user information. An explicit target set through URL.Opaque is kept, as
+// net/http does.
+func absoluteTarget(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.RequestURI()
+	}
+	stripped := *u
+	stripped.User = nil
+	stripped.Fragment = ""
+	return stripped.String()
+}
+
+// canonicalAddr returns u's host with the scheme's default port added when
+// it has none.
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// connBody closes the underlying connection once the response body is
+// closed.
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() bool
+}
+
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.stop()
+	b.conn.Close()
+	return err
+}
@@ -0,0 +1,197 @@
+package cobracurl
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRawServer accepts a single connection, sends the captured request head
+// on the returned channel and replies with response.
+func newRawServer(t *testing.T, response string) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		var head strings.Builder
+		for {
+			line, err := br.ReadString('\n')
+			head.WriteString(line)
+			if err != nil || line == "\r\n" {
+				break
+			}
+		}
+		ch <- head.String()
+		_, _ = io.WriteString(conn, response)
+	}()
+	return "http://" + ln.Addr().String(), ch
+}
+
+func TestRawTransportHTTP10(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Proto", r.Proto)
+		w.Header().Set("X-Connection", r.Header.Get("Connection"))
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &rawTransport{ProtoMajor: 1, ProtoMinor: 0}}
+	resp, err := client.Post(srv.URL+"/echo", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0", resp.Header.Get("X-Proto"))
+	assert.Empty(t, resp.Header.Get("X-Connection"))
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestRawTransportRequestLine(t *testing.T) {
+	srvURL, heads := newRawServer(t, "HTTP/1.0 200 OK\r\n\r\nbody")
+
+	req, err := http.NewRequest(http.MethodGet, srvURL+"/path?q=1", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Test", "1")
+
+	resp, err := (&rawTransport{ProtoMajor: 1, ProtoMinor: 0}).RoundTrip(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	head := <-heads
+	assert.True(t, strings.HasPrefix(head, "GET /path?q=1 HTTP/1.0\r\n"), head)
+	assert.Contains(t, head, "X-Test: 1\r\n")
+	assert.Equal(t, "body", string(body))
+}
+
+func TestRawTransportProxy(t *testing.T) {
+	proxyURL, heads := newRawServer(t, "HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n")
+	proxy, err := url.Parse(proxyURL)
+	require.NoError(t, err)
+	proxy.User = url.UserPassword("user", "pass")
+
+	transport := &rawTransport{Proxy: http.ProxyURL(proxy), ProtoMajor: 1, ProtoMinor: 0}
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/path", nil)
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	head := <-heads
+	assert.True(t, strings.HasPrefix(head, "GET http://example.com/path HTTP/1.0\r\n"), head)
+	assert.Contains(t, head, "Proxy-Authorization: Basic dXNlcjpwYXNz\r\n")
+	assert.Empty(t, req.Header.Get("Proxy-Authorization"))
+}
+
+func TestBuildClientHTTP09KeepsConnections(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("http0.9", true, "")
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+	assert.IsType(t, &http.Transport{}, client.Transport)
+
+	for range 3 {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+		assert.Equal(t, "HTTP/1.1", resp.Proto)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestBuildClientRawRequiresHTTP1(t *testing.T) {
+	for _, flag := range []string{"http2", "http2-prior-knowledge", "http3", "http3-only"} {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("raw", true, "")
+		cmd.Flags().Bool(flag, true, "")
+
+		_, err := BuildClient(cmd)
+		assert.Error(t, err, flag)
+	}
+}
+
+func TestBuildClientHTTP09AndRaw(t *testing.T) {
+	const chunked = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Encoding: gzip\r\n\r\n5\r\nhello\r\n0\r\n\r\n"
+	const plainChunked = "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"
+
+	tests := []struct {
+		name          string
+		response      string
+		flags         []string
+		expectedProto string
+		expectedBody  string
+		expectedError error
+	}{
+		{name: "HTTP/0.9 allowed", response: "legacy body", flags: []string{"http0.9"}, expectedProto: "HTTP/0.9", expectedBody: "legacy body"},
+		{name: "HTTP/0.9 allowed on a short response", response: "ok", flags: []string{"http0.9"}, expectedProto: "HTTP/0.9", expectedBody: "ok"},
+		{name: "HTTP/0.9 not allowed", response: "legacy body", expectedError: ErrHTTP09NotAllowed},
+		{name: "HTTP/0.9 not allowed with raw", response: "legacy body", flags: []string{"raw"}, expectedError: ErrHTTP09NotAllowed},
+		{name: "HTTP/0.9 not allowed with http1.0", response: "legacy body", flags: []string{"http1.0"}, expectedError: ErrHTTP09NotAllowed},
+		{name: "raw keeps chunked encoding", response: chunked, flags: []string{"raw"}, expectedProto: "HTTP/1.1", expectedBody: "5\r\nhello\r\n0\r\n\r\n"},
+		{name: "chunked encoding is decoded by default", response: plainChunked, flags: []string{"http0.9"}, expectedProto: "HTTP/1.1", expectedBody: "hello"},
+		{name: "raw honors Content-Length", response: "HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\nokignored", flags: []string{"raw"}, expectedProto: "HTTP/1.0", expectedBody: "ok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srvURL, _ := newRawServer(t, tt.response)
+
+			cmd := &cobra.Command{}
+			for _, flag := range tt.flags {
+				cmd.Flags().Bool(flag, true, "")
+			}
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			resp, err := client.Get(srvURL)
+			if tt.expectedError != nil {
+				require.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedProto, resp.Proto)
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package cobracurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// DefaultMaxRedirs is the --max-redirs value used when the flag is not
+// registered.
+const DefaultMaxRedirs = 30
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// TooManyRedirectsError is returned when a redirect chain exceeds
+// --max-redirs. It corresponds to curl exit code 47.
+type TooManyRedirectsError struct {
+	Max int
+}
+
+func (e *TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("maximum (%d) redirects followed", e.Max)
+}
+
+func (e *TooManyRedirectsError) Unwrap() error {
+	return ErrTooManyRedirects
+}
+
+// RedirectHop describes one redirect response followed by the client.
+// Start is when the request of the hop was sent, and Duration the time until
+// its response was received.
+type RedirectHop struct {
+	URL        *url.URL
+	StatusCode int
+	Header     http.Header
+	Location   string
+	Start      time.Time
+	Duration   time.Duration
+}
+
+// RedirectRecorder collects the redirect hops of a request sent through a
+// client built by BuildClient. Attach it with WithRedirectRecorder.
+//
+// Hops are timed by the recorder as the client follows them, whatever the
+// transport: each hop starts when the previous one was followed. The first
+// hop starts when its connection is requested on transports reporting it to
+// httptrace, such as http.Transport, and otherwise when the recorder was
+// attached.
+type RedirectRecorder struct {
+	mu    sync.Mutex
+	start time.Time
+	hops  []RedirectHop
+}
+
+// Hops returns the recorded hops in the order they were followed.
+func (r *RedirectRecorder) Hops() []RedirectHop {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RedirectHop(nil), r.hops...)
+}
+
+// begin sets the start of the first hop. Later hops start when the previous
+// one is recorded.
+func (r *RedirectRecorder) begin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.hops) == 0 {
+		r.start = time.Now()
+	}
+}
+
+func (r *RedirectRecorder) record(resp *http.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+	hop := RedirectHop{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Location:   resp.Header.Get("Location"),
+		Start:      r.start,
+		Duration:   now.Sub(r.start),
+	}
+	if resp.Request != nil {
+		hop.URL = resp.Request.URL
+	}
+	r.hops = append(r.hops, hop)
+	r.start = now
+}
+
+type redirectRecorderKey struct{}
+
+// WithRedirectRecorder returns a copy of ctx that makes clients built by
+// BuildClient record every followed redirect into rec.
+func WithRedirectRecorder(ctx context.Context, rec *RedirectRecorder) context.Context {
+	rec.begin()
+	ctx = context.WithValue(ctx, redirectRecorderKey{}, rec)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) { rec.begin() },
+	})
+}
+
+// RedirectRecorderFromContext returns the recorder attached to ctx, if any.
+func RedirectRecorderFromContext(ctx context.Context) *RedirectRecorder {
+	rec, _ := ctx.Value(redirectRecorderKey{}).(*RedirectRecorder)
+	return rec
+}
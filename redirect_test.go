@@ -0,0 +1,157 @@
+package cobracurl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedirectChainServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Hop", "a")
+		http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Hop", "b")
+		http.Redirect(w, r, "/c", http.StatusFound)
+	})
+	mux.HandleFunc("/c", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRedirectRecorder(t *testing.T) {
+	srv := newRedirectChainServer(t)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("location", true, "")
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+
+	rec := &RedirectRecorder{}
+	req, err := http.NewRequestWithContext(WithRedirectRecorder(context.Background(), rec), http.MethodGet, srv.URL+"/a", nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	hops := rec.Hops()
+	require.Len(t, hops, 2)
+
+	assert.Equal(t, srv.URL+"/a", hops[0].URL.String())
+	assert.Equal(t, http.StatusMovedPermanently, hops[0].StatusCode)
+	assert.Equal(t, "a", hops[0].Header.Get("X-Hop"))
+	assert.Equal(t, "/b", hops[0].Location)
+	assert.False(t, hops[0].Start.IsZero())
+	assert.Positive(t, hops[0].Duration)
+
+	assert.Equal(t, srv.URL+"/b", hops[1].URL.String())
+	assert.Equal(t, http.StatusFound, hops[1].StatusCode)
+	assert.Equal(t, "/c", hops[1].Location)
+}
+
+func TestRedirectRecorderTiming(t *testing.T) {
+	srv := newRedirectChainServer(t)
+
+	// The HTTP/1.0 and HTTP/3 transports do not report connections to
+	// httptrace.
+	for _, http10 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("http1.0=%v", http10), func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("location", true, "")
+			cmd.Flags().Bool("http1.0", http10, "")
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			rec := &RedirectRecorder{}
+			req, err := http.NewRequestWithContext(WithRedirectRecorder(context.Background(), rec), http.MethodGet, srv.URL+"/a", nil)
+			require.NoError(t, err)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			hops := rec.Hops()
+			require.Len(t, hops, 2)
+			for _, hop := range hops {
+				assert.False(t, hop.Start.IsZero())
+				assert.Positive(t, hop.Duration)
+			}
+			assert.True(t, hops[0].Start.Add(hops[0].Duration).Equal(hops[1].Start))
+		})
+	}
+}
+
+func TestRedirectRecorderNotFollowed(t *testing.T) {
+	srv := newRedirectChainServer(t)
+
+	client, err := BuildClient(&cobra.Command{})
+	require.NoError(t, err)
+
+	rec := &RedirectRecorder{}
+	req, err := http.NewRequestWithContext(WithRedirectRecorder(context.Background(), rec), http.MethodGet, srv.URL+"/a", nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Empty(t, rec.Hops())
+}
+
+func TestRedirectRecorderFromContext(t *testing.T) {
+	assert.Nil(t, RedirectRecorderFromContext(context.Background()))
+
+	rec := &RedirectRecorder{}
+	assert.Same(t, rec, RedirectRecorderFromContext(WithRedirectRecorder(context.Background(), rec)))
+}
+
+func TestBuildClientMaxRedirs(t *testing.T) {
+	srv := newRedirectChainServer(t)
+
+	tests := []struct {
+		maxRedirs   int
+		expectedErr bool
+	}{
+		{maxRedirs: -1},
+		{maxRedirs: 2},
+		{maxRedirs: 1, expectedErr: true},
+		{maxRedirs: 0, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxRedirs), func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("location", true, "")
+			cmd.Flags().Int("max-redirs", tt.maxRedirs, "")
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+
+			resp, err := client.Get(srv.URL + "/a")
+			if tt.expectedErr {
+				require.Error(t, err)
+				var tooMany *TooManyRedirectsError
+				require.ErrorAs(t, err, &tooMany)
+				assert.Equal(t, tt.maxRedirs, tooMany.Max)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package cobracurl
 
 import (
-	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -13,6 +15,44 @@ import (
 const DefaultUserAgent = "cobracurl (+https://github.com/cerberauth/cobracurl)"
 
 func BuildRequest(cmd *cobra.Command, args []string) (*http.Request, error) {
+	uploads, err := uploadFiles(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(uploads) > 1 {
+		return nil, fmt.Errorf("%w: %d files, use BuildRequests", ErrMultipleUploads, len(uploads))
+	}
+	var upload string
+	if len(uploads) == 1 {
+		upload = uploads[0]
+	}
+	return buildRequest(cmd, args, upload)
+}
+
+// BuildRequests builds the requests described by the command flags: one per
+// file when --upload-file expands to several, and a single one otherwise.
+func BuildRequests(cmd *cobra.Command, args []string) ([]*http.Request, error) {
+	uploads, err := uploadFiles(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(uploads) == 0 {
+		uploads = []string{""}
+	}
+
+	reqs := make([]*http.Request, 0, len(uploads))
+	for _, upload := range uploads {
+		req, err := buildRequest(cmd, args, upload)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// buildRequest builds a request, uploading the file at upload when set.
+func buildRequest(cmd *cobra.Command, args []string, upload string) (*http.Request, error) {
 	method, _ := cmd.Flags().GetString("request")
 	rawURL, _ := cmd.Flags().GetString("url")
 	if rawURL == "" && len(args) > 0 {
@@ -29,23 +69,19 @@ func BuildRequest(cmd *cobra.Command, args []string) (*http.Request, error) {
 		}
 	}
 
-	data, _ := cmd.Flags().GetString("data")
-	dataBinary, _ := cmd.Flags().GetString("data-binary")
-	dataRaw, _ := cmd.Flags().GetString("data-raw")
-	dataUrlencode, _ := cmd.Flags().GetString("data-urlencode")
+	data := orderedArgs(cmd, dataFlags...)
+	hasData := len(data) > 0 || len(orderedArgs(cmd, formFlags...)) > 0 || len(orderedArgs(cmd, "json")) > 0
+	if upload != "" && hasData {
+		return nil, ErrUploadWithData
+	}
 
 	if method == "" {
-		hasData := data != "" || dataBinary != "" || dataRaw != "" || dataUrlencode != ""
-		if !hasData {
-			if fm, _ := cmd.Flags().GetStringToString("form"); len(fm) > 0 {
-				hasData = true
-			} else if jd, _ := cmd.Flags().GetString("json"); jd != "" {
-				hasData = true
-			}
-		}
-		if hasData {
+		switch {
+		case upload != "":
+			method = http.MethodPut
+		case hasData:
 			method = http.MethodPost
-		} else {
+		default:
 			method = http.MethodGet
 		}
 	}
@@ -54,54 +90,90 @@ func BuildRequest(cmd *cobra.Command, args []string) (*http.Request, error) {
 		return nil, ErrMissingRequiredFields
 	}
 
-	var body string
+	rawURL, err := applyDefaultProtocol(cmd, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if rawURL, err = applyHSTS(cmd, rawURL); err != nil {
+		return nil, err
+	}
+	if allowed, _ := BuildProtocols(cmd); !allowed.Allows(urlScheme(rawURL)) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProtocol, urlScheme(rawURL))
+	}
+	if upload != "" {
+		rawURL = uploadURL(rawURL, upload)
+	}
+
+	var body *bodySource
 	var extraHeaders []string
 
 	switch {
-	case data != "":
-		body = data
-	case dataBinary != "":
-		body = dataBinary
-	case dataRaw != "":
-		body = dataRaw
-	case dataUrlencode != "":
-		body = encodeData(dataUrlencode)
+	case upload != "":
+		body, err = uploadBody(cmd, upload)
+	case len(data) > 0:
+		body, err = dataArgsBody(cmd, data)
 	default:
-		if formMap, _ := cmd.Flags().GetStringToString("form"); len(formMap) > 0 {
-			formData := make([]string, 0, len(formMap))
-			for k, v := range formMap {
-				formData = append(formData, k+"="+v)
-			}
-			body = strings.Join(formData, "&")
-			extraHeaders = append(extraHeaders, "Content-Type: application/x-www-form-urlencoded")
-		} else if jsonData, _ := cmd.Flags().GetString("json"); jsonData != "" {
-			body = jsonData
+		if form := orderedArgs(cmd, formFlags...); len(form) > 0 {
+			var boundary string
+			body, boundary, err = formArgsBody(cmd, form)
+			extraHeaders = append(extraHeaders, "Content-Type: multipart/form-data; boundary="+boundary)
+		} else if jsonArgs := orderedArgs(cmd, "json"); len(jsonArgs) > 0 {
+			body, err = jsonArgsBody(cmd, jsonArgs)
 			extraHeaders = append(extraHeaders, "Content-Type: application/json")
 			extraHeaders = append(extraHeaders, "Accept: application/json")
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	if forceGet && body != "" {
-		separator := "?"
-		if strings.Contains(rawURL, "?") {
-			separator = "&"
+	if forceGet && body != nil && upload == "" {
+		query, err := body.String()
+		if err != nil {
+			return nil, err
+		}
+		if query != "" {
+			separator := "?"
+			if strings.Contains(rawURL, "?") {
+				separator = "&"
+			}
+			rawURL = rawURL + separator + query
 		}
-		rawURL = rawURL + separator + body
-		body = ""
+		body = nil
 		extraHeaders = nil
 	}
+	if body == nil {
+		body = &bodySource{}
+	}
 
-	var requestBody *bytes.Reader
-	if body != "" {
-		requestBody = bytes.NewReader([]byte(body))
-	} else {
-		requestBody = bytes.NewReader(nil)
+	resume, resumed, err := buildResume(cmd, upload)
+	if err != nil {
+		return nil, err
+	}
+	var uploadRange string
+	if resumed && resume.upload {
+		if body, uploadRange, err = resumeUpload(body, resume.offset); err != nil {
+			return nil, err
+		}
+	}
+
+	// With --path-as-is the path may hold encodings net/url rejects; it is
+	// then only sent as the request target.
+	requestURL := rawURL
+	if pathAsIs, _ := cmd.Flags().GetBool("path-as-is"); pathAsIs {
+		if _, err := url.Parse(rawURL); err != nil {
+			requestURL, _ = splitRequestTarget(rawURL)
+		}
 	}
 
-	req, err := http.NewRequest(strings.ToUpper(method), rawURL, requestBody)
+	req, err := http.NewRequest(strings.ToUpper(method), requestURL, nil)
 	if err != nil {
 		return nil, err
 	}
+	if err := body.attach(req); err != nil {
+		return nil, err
+	}
+	applyRequestTarget(cmd, req.URL, rawURL)
 
 	if compressed, _ := cmd.Flags().GetBool("compressed"); compressed {
 		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
@@ -110,15 +182,29 @@ func BuildRequest(cmd *cobra.Command, args []string) (*http.Request, error) {
 	if rangeVal, _ := cmd.Flags().GetString("range"); rangeVal != "" {
 		req.Header.Set("Range", "bytes="+rangeVal)
 	}
+	if resumed {
+		// Like curl, --continue-at takes precedence over --range.
+		if resume.upload {
+			if uploadRange != "" {
+				req.Header.Set("Content-Range", uploadRange)
+			}
+		} else {
+			req.Header.Set("Range", "bytes="+strconv.FormatInt(resume.offset, 10)+"-")
+		}
+		req = req.WithContext(context.WithValue(req.Context(), resumeKey{}, resume))
+	}
 
 	if userAgent, _ := cmd.Flags().GetString("user-agent"); userAgent != "" {
 		req.Header.Set("User-Agent", userAgent)
 	}
 
-	if userArg, _ := cmd.Flags().GetString("user"); userArg != "" {
-		parts := strings.SplitN(userArg, ":", 2)
-		if len(parts) == 2 {
-			req.SetBasicAuth(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	if usesBasicAuth(cmd) {
+		username, password, ok, err := userCredentials(cmd, req.URL, true)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			req.SetBasicAuth(username, password)
 		}
 	}
 
@@ -167,14 +253,32 @@ func BuildRequest(cmd *cobra.Command, args []string) (*http.Request, error) {
 		req.Header.Set("User-Agent", DefaultUserAgent)
 	}
 
+	if err := applyAWSSigV4(cmd, req); err != nil {
+		return nil, err
+	}
+
 	return req, nil
 }
 
-func encodeData(s string) string {
-	if idx := strings.IndexByte(s, '='); idx >= 0 {
-		return s[:idx+1] + url.QueryEscape(s[idx+1:])
+// applyHSTS switches rawURL to https when --hsts lists its host.
+func applyHSTS(cmd *cobra.Command, rawURL string) (string, error) {
+	hstsFile, _ := cmd.Flags().GetString("hsts")
+	if hstsFile == "" || urlScheme(rawURL) != "http" {
+		return rawURL, nil
 	}
-	return url.QueryEscape(s)
+	cache, err := LoadHSTSCache(hstsFile)
+	if err != nil {
+		return "", err
+	}
+	base, _ := splitRequestTarget(rawURL)
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	if upgraded := cache.Upgrade(u); upgraded != u {
+		return upgraded.String() + rawURL[len(base):], nil
+	}
+	return rawURL, nil
 }
 
 var ErrMissingRequiredFields = errors.New("missing required field: url")
@@ -198,11 +302,14 @@ func BuildRequestHeaders(cmd *cobra.Command) (http.Header, []*http.Cookie, error
 		header.Set("User-Agent", userAgent)
 	}
 
-	if userArg, _ := cmd.Flags().GetString("user"); userArg != "" {
-		parts := strings.SplitN(userArg, ":", 2)
-		if len(parts) == 2 {
+	if usesBasicAuth(cmd) {
+		username, password, ok, err := userCredentials(cmd, flagURL(cmd), true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
 			req, _ := http.NewRequest(http.MethodGet, "http://x", nil)
-			req.SetBasicAuth(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+			req.SetBasicAuth(username, password)
 			header.Set("Authorization", req.Header.Get("Authorization"))
 		}
 	}
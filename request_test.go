@@ -184,7 +184,7 @@ func TestBuildRequest(t *testing.T) {
 			expectedError:  nil,
 			expectedURL:    "http://example.com",
 			expectedMethod: "POST",
-			expectedBody:   "hello+world",
+			expectedBody:   "hello%20world",
 		},
 		{
 			name: "POST request with data-urlencode (name=value)",
@@ -197,7 +197,7 @@ func TestBuildRequest(t *testing.T) {
 			expectedError:  nil,
 			expectedURL:    "http://example.com",
 			expectedMethod: "POST",
-			expectedBody:   "q=hello+world",
+			expectedBody:   "q=hello%20world",
 		},
 		{
 			name: "GET with data via --get appends to URL",
@@ -224,22 +224,6 @@ func TestBuildRequest(t *testing.T) {
 			expectedURL:    "http://example.com?existing=1&key=value",
 			expectedMethod: "GET",
 		},
-		{
-			name: "POST request with form data",
-			flags: map[string]interface{}{
-				"request": "POST",
-				"url":     "http://example.com",
-				"form":    map[string]string{"key": "value"},
-			},
-			args:           []string{},
-			expectedError:  nil,
-			expectedURL:    "http://example.com",
-			expectedMethod: "POST",
-			expectedBody:   "key=value",
-			expectedHeaders: map[string]string{
-				"Content-Type": "application/x-www-form-urlencoded",
-			},
-		},
 		{
 			name: "POST request with JSON",
 			flags: map[string]interface{}{
@@ -0,0 +1,232 @@
+package cobracurl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// ErrInvalidResume is returned when an upload cannot be resumed or appended,
+// or when the remote size needed by --append cannot be found.
+var ErrInvalidResume = errors.New("cannot resume transfer")
+
+// continueAtValue is the --continue-at offset. Like curl, "-" asks to find
+// the offset automatically; it reads as -1 through GetInt64.
+type continueAtValue int64
+
+func (v *continueAtValue) Set(s string) error {
+	if s == "-" {
+		*v = -1
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("negative offset %d", n)
+	}
+	*v = continueAtValue(n)
+	return nil
+}
+
+func (v *continueAtValue) Type() string {
+	return "int64"
+}
+
+func (v *continueAtValue) String() string {
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+type resumeKey struct{}
+
+// transferResume describes how a request resumes a transfer. It travels in
+// the request context to resumeTransport.
+type transferResume struct {
+	offset int64
+	upload bool
+	append bool
+}
+
+// buildResume reads --continue-at and --append. -C - resumes a download from
+// the size of the --output file; like curl, it resumes an upload from 0.
+// --append only applies to uploads.
+func buildResume(cmd *cobra.Command, upload string) (transferResume, bool, error) {
+	offset, _ := cmd.Flags().GetInt64("continue-at")
+	appendUpload, _ := cmd.Flags().GetBool("append")
+	resume := transferResume{upload: upload != "", append: appendUpload && upload != ""}
+
+	if offset < 0 && !resume.upload {
+		var err error
+		if offset, err = outputFileSize(cmd); err != nil {
+			return transferResume{}, false, err
+		}
+	}
+	resume.offset = max(offset, 0)
+
+	if resume.upload {
+		return resume, offset != 0 || resume.append, nil
+	}
+	return resume, resume.offset > 0, nil
+}
+
+// outputFileSize returns the size of the --output file, in --output-dir if
+// set, or 0 when there is none yet.
+func outputFileSize(cmd *cobra.Command) (int64, error) {
+	output, _ := cmd.Flags().GetString("output")
+	if output == "" || output == "-" {
+		return 0, nil
+	}
+	if dir, _ := cmd.Flags().GetString("output-dir"); dir != "" && !filepath.IsAbs(output) {
+		output = filepath.Join(dir, output)
+	}
+	info, err := os.Stat(output)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading output file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// resumeUpload returns body without its first offset bytes, and the
+// Content-Range curl sends for it. The upload length must be known.
+func resumeUpload(body *bodySource, offset int64) (*bodySource, string, error) {
+	if body.length < 0 {
+		return nil, "", fmt.Errorf("%w: the upload length is unknown", ErrInvalidResume)
+	}
+	if offset > 0 && offset >= body.length {
+		return nil, "", fmt.Errorf("%w: offset %d is beyond the upload size %d", ErrInvalidResume, offset, body.length)
+	}
+	if body.length == 0 {
+		return body, "", nil
+	}
+
+	open := body.open
+	skipped := &bodySource{
+		open: func() (io.ReadCloser, error) {
+			r, err := open()
+			if err != nil {
+				return nil, err
+			}
+			if seeker, ok := r.(io.Seeker); ok {
+				_, err = seeker.Seek(offset, io.SeekStart)
+			} else {
+				_, err = io.CopyN(io.Discard, r, offset)
+			}
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+			return r, nil
+		},
+		length:     body.length - offset,
+		replayable: body.replayable,
+	}
+	return skipped, contentRange(offset, body.length), nil
+}
+
+// contentRange returns the Content-Range of the bytes from offset to the end
+// of a size-byte upload.
+func contentRange(offset, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size)
+}
+
+// resumeTransport handles the responses to resumed transfers. A download
+// answered with 416 is already complete and gets an empty body; one answered
+// with 200 by a server ignoring Range has the bytes already received
+// skipped, so that appending the body completes the file either way. With
+// --append, uploads are sent after the remote content, whose size is asked
+// with HEAD.
+type resumeTransport struct {
+	next http.RoundTripper
+}
+
+func (t *resumeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resume, ok := req.Context().Value(resumeKey{}).(transferResume)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	if resume.append {
+		return t.appendUpload(req)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resume.upload || resume.offset == 0 {
+		return resp, err
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+	case http.StatusOK:
+		resp.Body = &skipReadCloser{ReadCloser: resp.Body, n: resume.offset}
+		if resp.ContentLength >= 0 {
+			resp.ContentLength = max(resp.ContentLength-resume.offset, 0)
+			resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+		}
+	}
+	return resp, nil
+}
+
+func (t *resumeTransport) appendUpload(req *http.Request) (*http.Response, error) {
+	head := req.Clone(req.Context())
+	head.Method = http.MethodHead
+	head.Body, head.GetBody, head.ContentLength = nil, nil, 0
+	head.Header.Del("Content-Range")
+
+	resp, err := t.next.RoundTrip(head)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	resp.Body = http.NoBody
+
+	var size int64
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+	case resp.StatusCode/100 == 2 && resp.ContentLength >= 0:
+		size = resp.ContentLength
+	default:
+		return nil, fmt.Errorf("%w: cannot find the size of %s: %s", ErrInvalidResume, req.URL.Redacted(), resp.Status)
+	}
+
+	if req.ContentLength == 0 {
+		// An empty PUT would truncate the remote content.
+		return resp, nil
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Del("Content-Range")
+	if size > 0 {
+		req.Header.Set("Content-Range", contentRange(size, size+req.ContentLength))
+	}
+	return t.next.RoundTrip(req)
+}
+
+// skipReadCloser drops the first n bytes read from its ReadCloser.
+type skipReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (s *skipReadCloser) Read(p []byte) (int, error) {
+	if s.n > 0 {
+		skipped, err := io.CopyN(io.Discard, s.ReadCloser, s.n)
+		s.n -= skipped
+		if err != nil {
+			return 0, err
+		}
+	}
+	return s.ReadCloser.Read(p)
+}
@@ -0,0 +1,261 @@
+package cobracurl
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinueAtFlag(t *testing.T) {
+	cmd := &cobra.Command{}
+	RegisterContinueAtFlag(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"-C", "-"}))
+	offset, err := cmd.Flags().GetInt64("continue-at")
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), offset)
+
+	require.NoError(t, cmd.Flags().Parse([]string{"--continue-at", "42"}))
+	offset, err = cmd.Flags().GetInt64("continue-at")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), offset)
+
+	assert.Error(t, cmd.Flags().Parse([]string{"-C", "-5"}))
+	assert.Error(t, cmd.Flags().Parse([]string{"-C", "abc"}))
+}
+
+// newRangeServer serves content, honoring single open-ended byte ranges
+// unless ignoreRange is set.
+func newRangeServer(t *testing.T, content string, ignoreRange bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+		if !ok || ignoreRange {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = io.WriteString(w, content)
+			return
+		}
+		offset, _ := strconv.Atoi(strings.TrimSuffix(start, "-"))
+		if offset >= len(content) {
+			w.Header().Set("Content-Range", "bytes */"+strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			_, _ = io.WriteString(w, "range not satisfiable")
+			return
+		}
+		w.Header().Set("Content-Range", "bytes "+start+strconv.Itoa(len(content)-1)+"/"+strconv.Itoa(len(content)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)-offset))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = io.WriteString(w, content[offset:])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResumeDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+
+	tests := []struct {
+		name           string
+		existing       string
+		ignoreRange    bool
+		expectedRange  string
+		expectedStatus int
+	}{
+		{name: "partial file", existing: content[:1234], expectedRange: "bytes=1234-", expectedStatus: http.StatusPartialContent},
+		{name: "complete file", existing: content, expectedRange: "bytes=10000-", expectedStatus: http.StatusRequestedRangeNotSatisfiable},
+		{name: "server ignoring Range", existing: content[:1234], ignoreRange: true, expectedRange: "bytes=1234-", expectedStatus: http.StatusOK},
+		{name: "no file yet", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newRangeServer(t, content, tt.ignoreRange)
+			dir := t.TempDir()
+			if tt.existing != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "dataset.bin"), []byte(tt.existing), 0o600))
+			}
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", srv.URL, "")
+			cmd.Flags().String("output", "dataset.bin", "")
+			cmd.Flags().String("output-dir", dir, "")
+			RegisterContinueAtFlag(cmd.Flags())
+			require.NoError(t, cmd.Flags().Parse([]string{"-C", "-"}))
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedRange, req.Header.Get("Range"))
+
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+
+			rest, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(rest)), resp.ContentLength)
+			assert.Equal(t, content, tt.existing+string(rest))
+		})
+	}
+}
+
+func TestResumeDownloadOffset(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+	cmd.Flags().Int64("continue-at", 100, "")
+	cmd.Flags().String("range", "0-1", "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "bytes=100-", req.Header.Get("Range"))
+}
+
+func TestResumeUpload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ten.txt")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o600))
+
+	tests := []struct {
+		name          string
+		continueAt    string
+		expectedRange string
+		expectedBody  string
+	}{
+		{name: "offset", continueAt: "4", expectedRange: "bytes 4-9/10", expectedBody: "456789"},
+		{name: "automatic offset", continueAt: "-", expectedRange: "bytes 0-9/10", expectedBody: "0123456789"},
+		{name: "no offset", continueAt: "0", expectedBody: "0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", "http://example.com/", "")
+			cmd.Flags().String("upload-file", path, "")
+			RegisterContinueAtFlag(cmd.Flags())
+			require.NoError(t, cmd.Flags().Parse([]string{"-C", tt.continueAt}))
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			assert.Equal(t, http.MethodPut, req.Method)
+			assert.Equal(t, "http://example.com/ten.txt", req.URL.String())
+			assert.Equal(t, tt.expectedRange, req.Header.Get("Content-Range"))
+			assert.Empty(t, req.Header.Get("Range"))
+			assert.Equal(t, int64(len(tt.expectedBody)), req.ContentLength)
+
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+
+			require.NotNil(t, req.GetBody)
+			replay, err := req.GetBody()
+			require.NoError(t, err)
+			body, err = io.ReadAll(replay)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestResumeUploadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ten.txt")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o600))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com/", "")
+	cmd.Flags().String("upload-file", path, "")
+	cmd.Flags().Int64("continue-at", 10, "")
+	_, err := BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, ErrInvalidResume)
+
+	cmd = &cobra.Command{}
+	cmd.SetIn(strings.NewReader("stdin"))
+	cmd.Flags().String("url", "http://example.com/", "")
+	cmd.Flags().String("upload-file", "-", "")
+	cmd.Flags().Bool("append", true, "")
+	_, err = BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, ErrInvalidResume)
+}
+
+func TestAppendUpload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	require.NoError(t, os.WriteFile(path, []byte("new lines\n"), 0o600))
+
+	tests := []struct {
+		name          string
+		remote        string
+		exists        bool
+		expectedRange string
+	}{
+		{name: "existing content", remote: "old lines\n", exists: true, expectedRange: "bytes 10-19/20"},
+		{name: "missing remote"},
+		{name: "empty remote", exists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var puts []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodHead:
+					if !tt.exists {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.remote)))
+				case http.MethodPut:
+					body, _ := io.ReadAll(r.Body)
+					assert.Equal(t, "new lines\n", string(body))
+					puts = append(puts, r.Header.Get("Content-Range"))
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", srv.URL+"/logs/", "")
+			cmd.Flags().String("upload-file", path, "")
+			RegisterAppendFlag(cmd.Flags())
+			require.NoError(t, cmd.Flags().Parse([]string{"--append"}))
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+			client, err := BuildClient(cmd)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, []string{tt.expectedRange}, puts)
+		})
+	}
+}
+
+func TestAppendUploadUnknownSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	require.NoError(t, os.WriteFile(path, []byte("new lines\n"), 0o600))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", srv.URL+"/logs/", "")
+	cmd.Flags().String("upload-file", path, "")
+	cmd.Flags().Bool("append", true, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	client, err := BuildClient(cmd)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, ErrInvalidResume)
+}
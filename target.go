@@ -0,0 +1,107 @@
+package cobracurl
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// applyRequestTarget sets the target written on the request line. With
+// --request-target the given value is sent verbatim, with --path-as-is the
+// path and query of rawURL are sent untouched, and otherwise "." and ".."
+// segments are removed from the path the way curl does.
+func applyRequestTarget(cmd *cobra.Command, u *url.URL, rawURL string) {
+	if target, _ := cmd.Flags().GetString("request-target"); target != "" {
+		setRequestTarget(u, target)
+		return
+	}
+
+	if pathAsIs, _ := cmd.Flags().GetBool("path-as-is"); pathAsIs {
+		if _, target := splitRequestTarget(rawURL); target != u.RequestURI() {
+			setRequestTarget(u, target)
+		}
+		return
+	}
+
+	if escaped := removeDotSegments(u.EscapedPath()); escaped != u.EscapedPath() {
+		if path, err := url.PathUnescape(escaped); err == nil {
+			u.Path, u.RawPath = path, escaped
+		}
+	}
+}
+
+// setRequestTarget makes u's request URI target, using URL.Opaque the way
+// net/http expects. Targets starting with "//" would otherwise be read as a
+// network path, so they are sent in absolute form.
+func setRequestTarget(u *url.URL, target string) {
+	if strings.HasPrefix(target, "//") {
+		target = "//" + u.Host + target
+	}
+	u.Opaque = target
+	u.RawQuery = ""
+	u.ForceQuery = false
+}
+
+// splitRequestTarget splits an absolute URL into its scheme and authority,
+// and the path and query that form the origin-form request target. The
+// fragment is dropped.
+func splitRequestTarget(rawURL string) (string, string) {
+	rest := rawURL
+	prefix := ""
+	if idx := strings.Index(rawURL, "://"); idx >= 0 {
+		prefix, rest = rawURL[:idx+3], rawURL[idx+3:]
+	}
+
+	end := strings.IndexAny(rest, "/?#")
+	if end < 0 {
+		return rawURL, "/"
+	}
+	base, target := prefix+rest[:end], rest[end:]
+	target, _, _ = strings.Cut(target, "#")
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+	return base, target
+}
+
+// removeDotSegments implements the remove_dot_segments algorithm of
+// RFC 3986 section 5.2.4.
+func removeDotSegments(path string) string {
+	var out []string
+	for in := path; in != ""; {
+		switch {
+		case strings.HasPrefix(in, "../"):
+			in = in[3:]
+		case strings.HasPrefix(in, "./"):
+			in = in[2:]
+		case strings.HasPrefix(in, "/./"):
+			in = in[2:]
+		case in == "/.":
+			in = "/"
+		case strings.HasPrefix(in, "/../"):
+			in = in[3:]
+			out = dropLastSegment(out)
+		case in == "/..":
+			in = "/"
+			out = dropLastSegment(out)
+		case in == "." || in == "..":
+			in = ""
+		default:
+			end := strings.IndexByte(in[1:], '/') + 1
+			if end == 0 {
+				end = len(in)
+			}
+			out = append(out, in[:end])
+			in = in[end:]
+		}
+	}
+	return strings.Join(out, "")
+}
+
+func dropLastSegment(segments []string) []string {
+	if len(segments) == 0 {
+		return segments
+	}
+	return segments[:len(segments)-1]
+}
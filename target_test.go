@@ -0,0 +1,94 @@
+package cobracurl
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveDotSegments(t *testing.T) {
+	tests := map[string]string{
+		"":                     "",
+		"/":                    "/",
+		"/a/b/c/./../../g":     "/a/g",
+		"mid/content=5/../6":   "mid/6",
+		"/../../etc/passwd":    "/etc/passwd",
+		"/a/b/..":              "/a/",
+		"/a/./b/.":             "/a/b/",
+		"/a/%2e%2e/b":          "/a/%2e%2e/b",
+		"/a//b/../c":           "/a//c",
+		"/a/..b/c":             "/a/..b/c",
+		"/static/../../secret": "/secret",
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, removeDotSegments(in), in)
+	}
+}
+
+func TestSplitRequestTarget(t *testing.T) {
+	tests := []struct {
+		rawURL         string
+		expectedBase   string
+		expectedTarget string
+	}{
+		{rawURL: "http://example.com", expectedBase: "http://example.com", expectedTarget: "/"},
+		{rawURL: "http://example.com/a/../b?x=%zz#frag", expectedBase: "http://example.com", expectedTarget: "/a/../b?x=%zz"},
+		{rawURL: "http://user@example.com:8080?q", expectedBase: "http://user@example.com:8080", expectedTarget: "/?q"},
+	}
+	for _, tt := range tests {
+		base, target := splitRequestTarget(tt.rawURL)
+		assert.Equal(t, tt.expectedBase, base, tt.rawURL)
+		assert.Equal(t, tt.expectedTarget, target, tt.rawURL)
+	}
+}
+
+func TestBuildRequestTarget(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		method        string
+		requestTarget string
+		pathAsIs      bool
+		expectedURI   string
+	}{
+		{name: "dot segments are removed", path: "/a/b/../../etc/passwd?x=1", expectedURI: "/etc/passwd?x=1"},
+		{name: "path-as-is keeps dot segments", path: "/a/b/../../etc/passwd?x=1", pathAsIs: true, expectedURI: "/a/b/../../etc/passwd?x=1"},
+		{name: "path-as-is keeps odd encodings", path: "/..%2f..%2F%2e%2e/%zz", pathAsIs: true, expectedURI: "/..%2f..%2F%2e%2e/%zz"},
+		{name: "path-as-is keeps backslashes", path: `/..\..\windows\win.ini`, pathAsIs: true, expectedURI: `/..\..\windows\win.ini`},
+		{name: "asterisk-form", path: "/ignored", method: http.MethodOptions, requestTarget: "*", expectedURI: "*"},
+		{name: "absolute-form", path: "/", requestTarget: "http://other.example.com/x?y", expectedURI: "http://other.example.com/x?y"},
+		{name: "origin-form replaces path and query", path: "/a?b=c", requestTarget: "/d/../e", expectedURI: "/d/../e"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srvURL, head := newRawServer(t, "HTTP/1.1 204 No Content\r\n\r\n")
+
+			cmd := &cobra.Command{}
+			cmd.Flags().String("url", srvURL+tt.path, "")
+			cmd.Flags().String("request", tt.method, "")
+			cmd.Flags().String("request-target", tt.requestTarget, "")
+			cmd.Flags().Bool("path-as-is", tt.pathAsIs, "")
+
+			req, err := BuildRequest(cmd, nil)
+			require.NoError(t, err)
+
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			require.NoError(t, err)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			requestLine, _, _ := strings.Cut(<-head, "\r\n")
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			assert.Equal(t, method+" "+tt.expectedURI+" HTTP/1.1", requestLine)
+		})
+	}
+}
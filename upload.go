@@ -0,0 +1,201 @@
+package cobracurl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ErrInvalidUploadGlob is returned for an --upload-file pattern with an
+// unmatched brace or bracket, or an invalid range.
+var ErrInvalidUploadGlob = errors.New("invalid upload-file glob")
+
+// ErrMultipleUploads is returned by BuildRequest when --upload-file expands
+// to several files; BuildRequests builds one request per file instead.
+var ErrMultipleUploads = errors.New("upload-file expands to several files")
+
+// ErrUploadWithData is returned when --upload-file is combined with a
+// --data, --form or --json body, which curl rejects too.
+var ErrUploadWithData = errors.New("upload-file cannot be combined with data, form or json")
+
+// uploadFiles returns the files named by --upload-file, expanding its {a,b}
+// lists and [1-9] ranges unless --globoff is set.
+func uploadFiles(cmd *cobra.Command) ([]string, error) {
+	pattern, _ := cmd.Flags().GetString("upload-file")
+	if pattern == "" {
+		return nil, nil
+	}
+	if globoff, _ := cmd.Flags().GetBool("globoff"); globoff {
+		return []string{pattern}, nil
+	}
+	return expandGlob(pattern)
+}
+
+// expandGlob expands a pattern in curl's globbing syntax: {a,b,c} lists and
+// [1-10], [01-10], [a-z] ranges with an optional :step. A backslash makes
+// the next character literal. Like curl, the last group varies fastest.
+func expandGlob(pattern string) ([]string, error) {
+	results := []string{""}
+	var literal strings.Builder
+	flush := func() {
+		for i := range results {
+			results[i] += literal.String()
+		}
+		literal.Reset()
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			literal.WriteByte(pattern[i])
+			continue
+		case '{', '[':
+		default:
+			literal.WriteByte(c)
+			continue
+		}
+
+		closing := byte('}')
+		if c == '[' {
+			closing = ']'
+		}
+		end := strings.IndexByte(pattern[i+1:], closing)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unmatched %q in %q", ErrInvalidUploadGlob, c, pattern)
+		}
+		group := pattern[i+1 : i+1+end]
+		i += end + 1
+
+		var alternatives []string
+		if c == '{' {
+			if strings.ContainsAny(group, "{[") {
+				return nil, fmt.Errorf("%w: nested group in %q", ErrInvalidUploadGlob, pattern)
+			}
+			alternatives = strings.Split(group, ",")
+		} else {
+			var err error
+			if alternatives, err = globRange(group); err != nil {
+				return nil, fmt.Errorf("%w: %q: %v", ErrInvalidUploadGlob, pattern, err)
+			}
+		}
+
+		flush()
+		expanded := make([]string, 0, len(results)*len(alternatives))
+		for _, prefix := range results {
+			for _, alternative := range alternatives {
+				expanded = append(expanded, prefix+alternative)
+			}
+		}
+		results = expanded
+	}
+	flush()
+	return results, nil
+}
+
+// globRange expands the body of a [start-end:step] range. Numeric ranges
+// keep the zero padding of start.
+func globRange(group string) ([]string, error) {
+	bounds, stepStr, hasStep := strings.Cut(group, ":")
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+			return nil, fmt.Errorf("bad step %q", stepStr)
+		}
+	}
+	start, end, ok := strings.Cut(bounds, "-")
+	if !ok {
+		return nil, fmt.Errorf("bad range %q", group)
+	}
+
+	var values []string
+	if len(start) == 1 && len(end) == 1 && isASCIILetter(start[0]) && isASCIILetter(end[0]) {
+		if start[0] > end[0] {
+			return nil, fmt.Errorf("bad range %q", group)
+		}
+		for c := int(start[0]); c <= int(end[0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+		return values, nil
+	}
+
+	from, err := strconv.Atoi(start)
+	if err != nil || from < 0 {
+		return nil, fmt.Errorf("bad range %q", group)
+	}
+	to, err := strconv.Atoi(end)
+	if err != nil || to < from {
+		return nil, fmt.Errorf("bad range %q", group)
+	}
+	width := 0
+	if len(start) > 1 && start[0] == '0' {
+		width = len(start)
+	}
+	for n := from; n <= to; n += step {
+		values = append(values, fmt.Sprintf("%0*d", width, n))
+	}
+	return values, nil
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isStdinUpload reports whether an --upload-file path reads stdin: curl
+// reads it for - and, without blocking, for ".".
+func isStdinUpload(path string) bool {
+	return path == "-" || path == "."
+}
+
+// uploadBody streams the file to upload, or stdin with chunked encoding.
+// With --crlf, line feeds are sent as CRLF.
+func uploadBody(cmd *cobra.Command, path string) (*bodySource, error) {
+	if isStdinUpload(path) {
+		path = "-"
+	}
+	body, err := fileBody(cmd, path, false)
+	if err != nil {
+		return nil, err
+	}
+	if crlf, _ := cmd.Flags().GetBool("crlf"); crlf {
+		return crlfBody(body)
+	}
+	return body, nil
+}
+
+// uploadURL appends the escaped base name of path to rawURL when, like
+// curl, its path is empty or ends with a slash. The query is kept.
+func uploadURL(rawURL, path string) string {
+	if isStdinUpload(path) {
+		return rawURL
+	}
+
+	rest := rawURL
+	offset := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		offset = i + 3
+		rest = rest[offset:]
+	}
+	end := strings.IndexAny(rest, "?#")
+	if end < 0 {
+		end = len(rest)
+	}
+	slash := strings.IndexByte(rest[:end], '/')
+	if slash >= 0 && !strings.HasSuffix(rest[:end], "/") {
+		return rawURL
+	}
+
+	name := escapeUnreserved(path[strings.LastIndexAny(path, `/\`)+1:])
+	if slash < 0 {
+		name = "/" + name
+	}
+	insert := offset + end
+	return rawURL[:insert] + name + rawURL[insert:]
+}
@@ -0,0 +1,227 @@
+package cobracurl
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "file.txt", expected: []string{"file.txt"}},
+		{pattern: "{a,b}.txt", expected: []string{"a.txt", "b.txt"}},
+		{pattern: "{a,b}{1,2}", expected: []string{"a1", "a2", "b1", "b2"}},
+		{pattern: "f{,.bak}", expected: []string{"f", "f.bak"}},
+		{pattern: "part[1-3]", expected: []string{"part1", "part2", "part3"}},
+		{pattern: "part[08-12:2]", expected: []string{"part08", "part10", "part12"}},
+		{pattern: "[a-c]", expected: []string{"a", "b", "c"}},
+		{pattern: `\{a,b\}`, expected: []string{"{a,b}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			files, err := expandGlob(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, files)
+		})
+	}
+
+	for _, pattern := range []string{"{a", "[1-", "[3-1]", "[1-3:0]", "{a,{b}}", "[a]"} {
+		_, err := expandGlob(pattern)
+		assert.ErrorIs(t, err, ErrInvalidUploadGlob, pattern)
+	}
+}
+
+func TestUploadURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		path     string
+		expected string
+	}{
+		{url: "http://example.com/up/", path: "dir/a b.txt", expected: "http://example.com/up/a%20b.txt"},
+		{url: "http://example.com", path: "a.txt", expected: "http://example.com/a.txt"},
+		{url: "http://example.com/?x=1", path: "a.txt", expected: "http://example.com/a.txt?x=1"},
+		{url: "http://example.com?x=1", path: "a.txt", expected: "http://example.com/a.txt?x=1"},
+		{url: "http://example.com/up", path: "a.txt", expected: "http://example.com/up"},
+		{url: "http://example.com/up/", path: `C:\dir\a.txt`, expected: "http://example.com/up/a.txt"},
+		{url: "http://example.com/up/", path: "-", expected: "http://example.com/up/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, uploadURL(tt.url, tt.path))
+		})
+	}
+}
+
+func TestBuildRequestUploadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifact.tar")
+	content := strings.Repeat("artifact", 100_000)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	type received struct {
+		method, path string
+		length       int64
+		body         string
+	}
+	ch := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ch <- received{method: r.Method, path: r.URL.Path, length: r.ContentLength, body: string(body)}
+	}))
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", srv.URL+"/bucket/", "")
+	cmd.Flags().String("upload-file", path, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, req.Method)
+	assert.Equal(t, int64(len(content)), req.ContentLength)
+	require.NotNil(t, req.GetBody)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, received{method: http.MethodPut, path: "/bucket/artifact.tar", length: int64(len(content)), body: content}, <-ch)
+}
+
+func TestBuildRequestUploadStdin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, []string{"chunked"}, r.TransferEncoding)
+		assert.Equal(t, "/bucket/", r.URL.Path)
+		assert.Equal(t, "from stdin", string(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.SetIn(strings.NewReader("from stdin"))
+	cmd.Flags().String("url", srv.URL+"/bucket/", "")
+	RegisterUploadFileFlag(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"-T", "-"}))
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), req.ContentLength)
+	assert.Nil(t, req.GetBody)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestBuildRequestsUploadGlob(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("A"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("BB"), 0o600))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com/up/", "")
+	cmd.Flags().String("request", "POST", "")
+	cmd.Flags().String("upload-file", filepath.Join(dir, "{a,b}.txt"), "")
+
+	reqs, err := BuildRequests(cmd, nil)
+	require.NoError(t, err)
+	require.Len(t, reqs, 2)
+	for i, expected := range []struct{ url, body string }{
+		{url: "http://example.com/up/a.txt", body: "A"},
+		{url: "http://example.com/up/b.txt", body: "BB"},
+	} {
+		assert.Equal(t, http.MethodPost, reqs[i].Method)
+		assert.Equal(t, expected.url, reqs[i].URL.String())
+		body, err := io.ReadAll(reqs[i].Body)
+		require.NoError(t, err)
+		assert.Equal(t, expected.body, string(body))
+	}
+
+	_, err = BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, ErrMultipleUploads)
+}
+
+func TestBuildRequestsWithoutUpload(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com", "")
+
+	reqs, err := BuildRequests(cmd, nil)
+	require.NoError(t, err)
+	require.Len(t, reqs, 1)
+	assert.Equal(t, http.MethodGet, reqs[0].Method)
+}
+
+func TestBuildRequestUploadGloboff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "{a,b}.txt")
+	require.NoError(t, os.WriteFile(path, []byte("literal"), 0o600))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com/", "")
+	cmd.Flags().String("upload-file", path, "")
+	cmd.Flags().Bool("globoff", true, "")
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/%7Ba%2Cb%7D.txt", req.URL.String())
+}
+
+func TestBuildRequestUploadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com/", "")
+	cmd.Flags().String("upload-file", filepath.Join(dir, "missing"), "")
+	_, err := BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	cmd = &cobra.Command{}
+	cmd.Flags().String("url", "http://example.com/", "")
+	cmd.Flags().String("upload-file", filepath.Join(dir, "missing"), "")
+	cmd.Flags().String("data", "a=1", "")
+	_, err = BuildRequest(cmd, nil)
+	assert.ErrorIs(t, err, ErrUploadWithData)
+}
+
+func TestBuildRequestUploadCRLF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.txt")
+	content := strings.Repeat("RECORD\n", 50_000)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	expected := strings.ReplaceAll(content, "\n", "\r\n")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, int64(len(expected)), r.ContentLength)
+		assert.Equal(t, expected, string(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("url", srv.URL+"/", "")
+	cmd.Flags().String("upload-file", path, "")
+	RegisterCrlfFlag(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"--crlf"}))
+
+	req, err := BuildRequest(cmd, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(expected)), req.ContentLength)
+	for range 2 {
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		req.Body, err = req.GetBody()
+		require.NoError(t, err)
+	}
+}